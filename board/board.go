@@ -0,0 +1,472 @@
+// Package board implements the public bulletin board of an election: an
+// append-only, file-backed log of serialized ciphertexts with a Merkle tree
+// over them (see package merkle).
+//
+// The board operator publishes signed tree heads that commit to the log
+// contents and to the election manifest, hands every voter an inclusion
+// proof for their ballot, and proves with consistency proofs that every tree
+// head extends the previous ones. Replicas gossip tree heads to catch an
+// operator showing different logs to different observers. Anyone holding the
+// log can recompute the tally with Tally, which adds exactly the logged
+// ciphertexts.
+//
+// Ballots opened for a cast-or-audit challenge are recorded as spoiled in a
+// second file next to the log, and the board refuses to post them.
+package board
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/p4u/m1fp-go/m1fp"
+	"github.com/p4u/m1fp-go/manifest"
+	"github.com/p4u/m1fp-go/merkle"
+)
+
+// maxEntry bounds the size of a single log record.
+const maxEntry = 1 << 20
+
+// spoiledSuffix is appended to the log path to name the file of spoiled
+// ballots, which holds their encodings in the record format of the log.
+const spoiledSuffix = ".spoiled"
+
+// treeHeadDomain separates tree head signatures from other Ed25519 messages.
+const treeHeadDomain = "m1fp/board/tree-head"
+
+// TreeHead is a signed commitment to the first Size entries of a board.
+type TreeHead struct {
+	Manifest  manifest.Hash `json:"manifest"`  // Election the board belongs to
+	Size      uint64        `json:"size"`      // Number of entries covered
+	Root      merkle.Hash   `json:"root"`      // Merkle root of those entries
+	Timestamp int64         `json:"timestamp"` // Unix time of signing, in milliseconds
+	Signature []byte        `json:"signature"` // Ed25519 signature of the board key
+}
+
+// InclusionProof shows that an entry is part of the tree of a tree head.
+type InclusionProof struct {
+	Index    uint64        `json:"index"`
+	TreeSize uint64        `json:"tree_size"`
+	Path     []merkle.Hash `json:"path"`
+}
+
+// Board is an append-only ballot log. It is safe for concurrent use.
+type Board struct {
+	mu       sync.Mutex
+	f        *os.File
+	manifest manifest.Hash
+	pk       *m1fp.PublicKey
+	key      ed25519.PrivateKey
+	tree     merkle.Tree
+	entries  [][]byte
+	offset   int64 // End of the last durable log record
+	err      error // Set when a file may no longer match memory
+
+	spoiledLog    *os.File                 // Encodings of spoiled ballots
+	spoiledOffset int64                    // End of the last durable spoiled record
+	spoiled       map[merkle.Hash]struct{} // Leaf hashes of spoiled ballots
+	posted        map[merkle.Hash]struct{} // Leaf hashes of logged entries
+}
+
+// Open opens or creates the board log at path for the election identified
+// by the manifest hash, whose ciphertexts are under pk, signing tree heads
+// with key. Existing records are replayed to rebuild the tree, and the
+// spoiled ballots are read from the file at path with the spoiledSuffix; a
+// torn record left by a crash at the end of either file is discarded.
+func Open(path string, h manifest.Hash, pk *m1fp.PublicKey, key ed25519.PrivateKey) (*Board, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid board signing key")
+	}
+	if pk == nil || pk.D == nil {
+		return nil, fmt.Errorf("invalid election key")
+	}
+	b := &Board{
+		manifest: h,
+		pk:       pk,
+		key:      key,
+		spoiled:  make(map[merkle.Hash]struct{}),
+		posted:   make(map[merkle.Hash]struct{}),
+	}
+	var err error
+	if b.f, b.offset, err = b.openLog(path, func(data []byte) {
+		b.entries = append(b.entries, data)
+		b.tree.Append(data)
+		b.posted[merkle.LeafHash(data)] = struct{}{}
+	}); err != nil {
+		return nil, err
+	}
+	if b.spoiledLog, b.spoiledOffset, err = b.openLog(path+spoiledSuffix, func(data []byte) {
+		b.spoiled[merkle.LeafHash(data)] = struct{}{}
+	}); err != nil {
+		b.f.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// openLog opens or creates the record file at path, calls fn on every
+// ciphertext record in it, truncates a torn record at its end and returns
+// the file with its size.
+func (b *Board) openLog(path string, fn func(data []byte)) (*os.File, int64, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, 0, err
+	}
+	valid, _, err := readRecords(f, func(data []byte) error {
+		if _, err := b.decode(data); err != nil {
+			return err
+		}
+		fn(data)
+		return nil
+	})
+	if err == nil {
+		err = f.Truncate(valid)
+	}
+	if err == nil {
+		_, err = f.Seek(valid, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, valid, nil
+}
+
+// decode parses a serialized ciphertext and checks that it is under the
+// election key of the board.
+func (b *Board) decode(data []byte) (*m1fp.Ciphertext, error) {
+	ct := new(m1fp.Ciphertext)
+	if err := ct.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	if err := b.pk.CheckDomain(ct); err != nil {
+		return nil, err
+	}
+	return ct, nil
+}
+
+// Close closes the log and spoiled ballot files.
+func (b *Board) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	err := b.f.Close()
+	if serr := b.spoiledLog.Close(); err == nil {
+		err = serr
+	}
+	b.err = fmt.Errorf("board closed")
+	return err
+}
+
+// PublicKey returns the key that verifies the tree heads of the board.
+func (b *Board) PublicKey() ed25519.PublicKey {
+	return b.key.Public().(ed25519.PublicKey)
+}
+
+// Append serializes ct, writes it durably to the log and returns its index.
+// A ciphertext under another key or recorded as spoiled by Spoil is
+// refused. If the log cannot be written the board fails and must be
+// reopened.
+func (b *Board) Append(ct *m1fp.Ciphertext) (uint64, error) {
+	if err := b.pk.CheckDomain(ct); err != nil {
+		return 0, err
+	}
+	data, err := ct.MarshalBinary()
+	if err != nil {
+		return 0, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.spoiled[merkle.LeafHash(data)]; ok {
+		return 0, fmt.Errorf("spoiled ciphertext cannot be posted")
+	}
+	return b.appendEntries(data)
+}
+
+// AppendAll writes every ciphertext of cts durably to the log and returns
+// the index of the first. Either all of them are logged or none is.
+func (b *Board) AppendAll(cts []*m1fp.Ciphertext) (uint64, error) {
+	batch := make([][]byte, len(cts))
+	for i, ct := range cts {
+		if err := b.pk.CheckDomain(ct); err != nil {
+			return 0, fmt.Errorf("ciphertext %d: %w", i, err)
+		}
+		data, err := ct.MarshalBinary()
+		if err != nil {
+			return 0, fmt.Errorf("ciphertext %d: %w", i, err)
+		}
+		batch[i] = data
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, data := range batch {
+		if _, ok := b.spoiled[merkle.LeafHash(data)]; ok {
+			return 0, fmt.Errorf("ciphertext %d: spoiled ciphertext cannot be posted", i)
+		}
+	}
+	return b.appendEntries(batch...)
+}
+
+// appendEntries writes serialized ciphertexts to the log with a single sync
+// and adds them to the tree, returning the index of the first.
+func (b *Board) appendEntries(batch ...[]byte) (uint64, error) {
+	var buf []byte
+	for _, data := range batch {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(data)))
+		buf = append(buf, data...)
+	}
+	if err := b.write(b.f, &b.offset, buf); err != nil {
+		return 0, err
+	}
+	first := b.tree.Size()
+	for _, data := range batch {
+		b.entries = append(b.entries, data)
+		b.posted[merkle.LeafHash(data)] = struct{}{}
+		b.tree.Append(data)
+	}
+	return first, nil
+}
+
+// Spoil records the ciphertext of an audited ballot as spoiled, so that it
+// can never be posted. The opening is checked first, and a ballot that is
+// already on the board cannot be spoiled; in both cases nothing is
+// recorded.
+func (b *Board) Spoil(a *m1fp.AuditBallot) error {
+	if err := a.Verify(b.pk); err != nil {
+		return fmt.Errorf("invalid audit ballot: %w", err)
+	}
+	data, err := a.Ciphertext.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	leaf := merkle.LeafHash(data)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.posted[leaf]; ok {
+		return fmt.Errorf("ballot already cast")
+	}
+	if _, ok := b.spoiled[leaf]; ok {
+		return nil
+	}
+	rec := binary.BigEndian.AppendUint32(nil, uint32(len(data)))
+	if err := b.write(b.spoiledLog, &b.spoiledOffset, append(rec, data...)); err != nil {
+		return err
+	}
+	b.spoiled[leaf] = struct{}{}
+	return nil
+}
+
+// write appends rec to f, which ends at *offset, and syncs it. If either
+// fails, a partial record is truncated away and the board fails: after a
+// failed sync the file contents are unknown, so it must be reopened.
+func (b *Board) write(f *os.File, offset *int64, rec []byte) error {
+	if b.err != nil {
+		return b.err
+	}
+	_, err := f.Write(rec)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		b.err = fmt.Errorf("board log failed, reopen the board: %w", err)
+		if terr := f.Truncate(*offset); terr != nil {
+			b.err = fmt.Errorf("%w (truncating: %v)", b.err, terr)
+		}
+		return b.err
+	}
+	*offset += int64(len(rec))
+	return nil
+}
+
+// Size returns the number of logged entries.
+func (b *Board) Size() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tree.Size()
+}
+
+// Entry returns the ciphertext logged at index.
+func (b *Board) Entry(index uint64) (*m1fp.Ciphertext, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if index >= b.tree.Size() {
+		return nil, fmt.Errorf("entry %d beyond %d entries", index, b.tree.Size())
+	}
+	ct := new(m1fp.Ciphertext)
+	if err := ct.UnmarshalBinary(b.entries[index]); err != nil {
+		return nil, fmt.Errorf("entry %d: %w", index, err)
+	}
+	return ct, nil
+}
+
+// TreeHead signs the current state of the log.
+func (b *Board) TreeHead() (*TreeHead, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	th := &TreeHead{
+		Manifest:  b.manifest,
+		Size:      b.tree.Size(),
+		Root:      b.tree.Root(),
+		Timestamp: time.Now().UnixMilli(),
+	}
+	th.Signature = ed25519.Sign(b.key, th.message())
+	return th, nil
+}
+
+// InclusionProof proves that entry index is part of the tree of size entries,
+// typically the size of the latest tree head.
+func (b *Board) InclusionProof(index, size uint64) (*InclusionProof, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	path, err := b.tree.InclusionProof(index, size)
+	if err != nil {
+		return nil, err
+	}
+	return &InclusionProof{Index: index, TreeSize: size, Path: path}, nil
+}
+
+// ConsistencyProof proves that the tree of the first first entries is a
+// prefix of the tree of the first second entries.
+func (b *Board) ConsistencyProof(first, second uint64) ([]merkle.Hash, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tree.ConsistencyProof(first, second)
+}
+
+// Tally adds every logged ciphertext with AddMany. An empty board has no tally.
+func (b *Board) Tally(prec uint16) (*m1fp.Ciphertext, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.entries) == 0 {
+		return nil, fmt.Errorf("empty board")
+	}
+	cts := make([]*m1fp.Ciphertext, len(b.entries))
+	for i, data := range b.entries {
+		cts[i] = new(m1fp.Ciphertext)
+		if err := cts[i].UnmarshalBinary(data); err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+	}
+	return m1fp.AddMany(prec, cts...)
+}
+
+// VerifyTreeHead checks the signature of th under the board key pub.
+func VerifyTreeHead(pub ed25519.PublicKey, th *TreeHead) error {
+	if th == nil {
+		return fmt.Errorf("nil tree head")
+	}
+	if len(pub) != ed25519.PublicKeySize || !ed25519.Verify(pub, th.message(), th.Signature) {
+		return fmt.Errorf("invalid tree head signature")
+	}
+	return nil
+}
+
+// VerifyInclusion checks that ct is logged under a signed tree head. The
+// tree head signature should have been checked with VerifyTreeHead.
+func VerifyInclusion(th *TreeHead, ct *m1fp.Ciphertext, proof *InclusionProof) error {
+	if th == nil || proof == nil {
+		return fmt.Errorf("missing tree head or proof")
+	}
+	if proof.TreeSize != th.Size {
+		return fmt.Errorf("proof for tree size %d, tree head covers %d", proof.TreeSize, th.Size)
+	}
+	data, err := ct.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return merkle.VerifyInclusion(merkle.LeafHash(data), proof.Index, proof.TreeSize, proof.Path, th.Root)
+}
+
+// VerifyConsistency checks that the log committed to by newer extends the
+// one committed to by older, so the operator did not rewrite history
+// between the two tree heads. Signatures should have been checked with
+// VerifyTreeHead.
+func VerifyConsistency(older, newer *TreeHead, proof []merkle.Hash) error {
+	if older == nil || newer == nil {
+		return fmt.Errorf("missing tree head")
+	}
+	if older.Manifest != newer.Manifest {
+		return fmt.Errorf("tree heads belong to different elections")
+	}
+	return merkle.VerifyConsistency(older.Size, newer.Size, older.Root, newer.Root, proof)
+}
+
+// message returns the bytes covered by the tree head signature:
+// domain || manifest hash || size (uint64 BE) || timestamp (uint64 BE) || root.
+func (th *TreeHead) message() []byte {
+	msg := make([]byte, 0, len(treeHeadDomain)+len(th.Manifest)+16+len(th.Root))
+	msg = append(msg, treeHeadDomain...)
+	msg = append(msg, th.Manifest[:]...)
+	msg = binary.BigEndian.AppendUint64(msg, th.Size)
+	msg = binary.BigEndian.AppendUint64(msg, uint64(th.Timestamp))
+	return append(msg, th.Root[:]...)
+}
+
+// ReadLog reads the board log at path without opening it for writing, as
+// an observer holding a copy of the log would. Unlike Open, it rejects a log
+// ending in a torn record.
+func ReadLog(path string) ([]*m1fp.Ciphertext, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var cts []*m1fp.Ciphertext
+	_, torn, err := readRecords(f, func(data []byte) error {
+		ct := new(m1fp.Ciphertext)
+		if err := ct.UnmarshalBinary(data); err != nil {
+			return err
+		}
+		cts = append(cts, ct)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if torn {
+		return nil, fmt.Errorf("board log ends in a torn record")
+	}
+	return cts, nil
+}
+
+// readRecords calls fn on every complete record read from f. It returns the
+// offset just past the last complete record and whether a torn record
+// follows it.
+func readRecords(f io.Reader, fn func(data []byte) error) (offset int64, torn bool, err error) {
+	r := bufio.NewReader(f)
+	var hdr [4]byte
+	for i := 0; ; i++ {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return offset, false, nil
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return offset, true, nil
+			}
+			return 0, false, err
+		}
+		n := binary.BigEndian.Uint32(hdr[:])
+		if n > maxEntry {
+			return 0, false, fmt.Errorf("board record %d: size %d exceeds limit", i, n)
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(r, data); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return offset, true, nil
+			}
+			return 0, false, err
+		}
+		if err := fn(data); err != nil {
+			return 0, false, fmt.Errorf("board record %d: %w", i, err)
+		}
+		offset += 4 + int64(n)
+	}
+}
@@ -0,0 +1,256 @@
+package board
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/p4u/m1fp-go/m1fp"
+	"github.com/p4u/m1fp-go/manifest"
+)
+
+func testBoard(t *testing.T, pk *m1fp.PublicKey) (*Board, string, ed25519.PrivateKey) {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "board.log")
+	b, err := Open(path, manifest.Hash{1}, pk, key)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	return b, path, key
+}
+
+func TestBoardInclusionAndTally(t *testing.T) {
+	sk, pk, err := m1fp.KeyGen(256, m1fp.X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+	b, path, key := testBoard(t, pk)
+
+	votes := []uint64{3, 0, 7, 1, 4}
+	var cts []*m1fp.Ciphertext
+	for _, v := range votes {
+		ct, _, err := m1fp.EncryptVote(pk, v, nil)
+		if err != nil {
+			t.Fatalf("EncryptVote failed: %v", err)
+		}
+		if _, err := b.Append(ct); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+		cts = append(cts, ct)
+	}
+
+	th, err := b.TreeHead()
+	if err != nil {
+		t.Fatalf("TreeHead failed: %v", err)
+	}
+	if err := VerifyTreeHead(b.PublicKey(), th); err != nil {
+		t.Fatalf("valid tree head rejected: %v", err)
+	}
+	for i, ct := range cts {
+		proof, err := b.InclusionProof(uint64(i), th.Size)
+		if err != nil {
+			t.Fatalf("InclusionProof failed: %v", err)
+		}
+		if err := VerifyInclusion(th, ct, proof); err != nil {
+			t.Fatalf("ballot %d not included: %v", i, err)
+		}
+	}
+	forged := *th
+	forged.Size--
+	if err := VerifyTreeHead(b.PublicKey(), &forged); err == nil {
+		t.Fatalf("altered tree head accepted")
+	}
+
+	// Reopen and check that the log, the root and the tally are unchanged.
+	if err := b.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	b, err = Open(path, manifest.Hash{1}, pk, key)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer b.Close()
+	again, _ := b.TreeHead()
+	if again.Size != th.Size || again.Root != th.Root {
+		t.Fatalf("reopened board has size %d root %s, want %d %s", again.Size, again.Root, th.Size, th.Root)
+	}
+	sum, err := b.Tally(pk.Prec)
+	if err != nil {
+		t.Fatalf("Tally failed: %v", err)
+	}
+	if got, err := m1fp.DecryptVote(sk, sum); err != nil || got != 15 {
+		t.Fatalf("tally decrypts to %d (%v), want 15", got, err)
+	}
+}
+
+func TestBoardDiscardsTornRecord(t *testing.T) {
+	_, pk, err := m1fp.KeyGen(256, m1fp.X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+	b, path, key := testBoard(t, pk)
+	ct, _, err := m1fp.EncryptVote(pk, 2, nil)
+	if err != nil {
+		t.Fatalf("EncryptVote failed: %v", err)
+	}
+	if _, err := b.Append(ct); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	b.Close()
+
+	// Simulate a crash in the middle of writing a second record.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	f.Write([]byte{0, 0, 0, 90, 1, 2, 3})
+	f.Close()
+
+	b, err = Open(path, manifest.Hash{1}, pk, key)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer b.Close()
+	if b.Size() != 1 {
+		t.Fatalf("board size %d after torn write, want 1", b.Size())
+	}
+	if _, err := b.Append(ct); err != nil {
+		t.Fatalf("Append after recovery failed: %v", err)
+	}
+	if got, _ := b.Entry(1); got == nil || got.GetC1Int().Cmp(ct.GetC1Int()) != 0 {
+		t.Fatalf("entry appended after recovery is corrupted")
+	}
+}
+
+func TestBoardRefusesSpoiledBallots(t *testing.T) {
+	_, pk, err := m1fp.KeyGen(256, m1fp.X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+	b, path, key := testBoard(t, pk)
+	r := big.NewInt(99)
+	ct, _, err := m1fp.EncryptVote(pk, 5, r)
+	if err != nil {
+		t.Fatalf("EncryptVote failed: %v", err)
+	}
+
+	// A false opening is rejected and leaves the ballot castable.
+	forged := &m1fp.AuditBallot{Ciphertext: ct, Vote: 6, R: r}
+	if err := b.Spoil(forged); err == nil {
+		t.Fatalf("false opening spoiled a ballot")
+	}
+	audit, err := m1fp.Audit(pk, ct, 5, r)
+	if err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+	if err := b.Spoil(audit); err != nil {
+		t.Fatalf("Spoil failed: %v", err)
+	}
+	if _, err := b.Append(ct); err == nil {
+		t.Fatalf("spoiled ballot posted")
+	}
+
+	// The ballot stays spoiled across a restart, even when decoded afresh.
+	b.Close()
+	b, err = Open(path, manifest.Hash{1}, pk, key)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer b.Close()
+	data, _ := ct.MarshalBinary()
+	var decoded m1fp.Ciphertext
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	if _, err := b.Append(&decoded); err == nil {
+		t.Fatalf("spoiled ballot posted after reopening")
+	}
+
+	// A cast ballot can no longer be audited.
+	other, _, _ := m1fp.EncryptVote(pk, 2, r)
+	if _, err := b.Append(other); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	audit, _ = m1fp.Audit(pk, other, 2, r)
+	if err := b.Spoil(audit); err == nil {
+		t.Fatalf("cast ballot spoiled")
+	}
+}
+
+func TestBoardRejectsForeignCiphertexts(t *testing.T) {
+	_, pk, err := m1fp.KeyGen(256, m1fp.X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+	_, other, err := m1fp.KeyGen(320, m1fp.X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+	b, _, _ := testBoard(t, pk)
+	defer b.Close()
+	foreign, _, err := m1fp.EncryptVote(other, 1, nil)
+	if err != nil {
+		t.Fatalf("EncryptVote failed: %v", err)
+	}
+	if _, err := b.Append(foreign); err == nil {
+		t.Fatalf("ciphertext under another key posted")
+	}
+	own, _, _ := m1fp.EncryptVote(pk, 1, nil)
+	if _, err := b.AppendAll([]*m1fp.Ciphertext{own, foreign}); err == nil {
+		t.Fatalf("batch with a ciphertext under another key posted")
+	}
+	if b.Size() != 0 {
+		t.Fatalf("board holds %d entries after rejected appends", b.Size())
+	}
+}
+
+func TestBoardFailsAfterWriteError(t *testing.T) {
+	_, pk, err := m1fp.KeyGen(256, m1fp.X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+	b, path, key := testBoard(t, pk)
+	ct, _, _ := m1fp.EncryptVote(pk, 2, nil)
+	if _, err := b.Append(ct); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	// Swap the log for a read-only handle so that the next write fails.
+	f := b.f
+	readOnly, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	b.f = readOnly
+	if _, err := b.Append(ct); err == nil {
+		t.Fatalf("Append succeeded on a failed log")
+	}
+	b.f = f
+	readOnly.Close()
+	if _, err := b.Append(ct); err == nil {
+		t.Fatalf("failed board accepted another entry")
+	}
+	if b.Size() != 1 {
+		t.Fatalf("board size %d after a failed write, want 1", b.Size())
+	}
+	b.Close()
+
+	b, err = Open(path, manifest.Hash{1}, pk, key)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer b.Close()
+	if b.Size() != 1 {
+		t.Fatalf("reopened board has %d entries, want 1", b.Size())
+	}
+	if _, err := b.Append(ct); err != nil {
+		t.Fatalf("Append after reopening failed: %v", err)
+	}
+}
@@ -0,0 +1,283 @@
+package board
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/p4u/m1fp-go/merkle"
+)
+
+// maxBatch bounds the number of entries served by one entries request.
+const maxBatch = 256
+
+// ErrFork is returned, wrapped, when gossip uncovers two tree heads signed
+// by the operator that cannot describe the same append-only log.
+var ErrFork = errors.New("board fork detected")
+
+// Fork is the evidence of an equivocating operator: two tree heads, both
+// signed by the operator key, that are not consistent with each other.
+// Anyone holding the operator key can check it with VerifyFork, without
+// trusting the replica that raised it.
+//
+// When the heads have different sizes, Root is the root of the larger
+// head's log at the size of the smaller head and Proof the consistency
+// proof from Root to the larger head; Root differing from the smaller
+// head's root shows the two logs diverge. Both are empty for heads of the
+// same size, whose roots differ.
+type Fork struct {
+	Peer   string    // Replica that presented the conflicting head
+	Local  *TreeHead // Head held by the detecting replica
+	Remote *TreeHead // Head presented by the peer
+	Root   merkle.Hash
+	Proof  []merkle.Hash
+	Reason string
+}
+
+// VerifyFork checks that f proves the operator signed two tree heads that
+// cannot describe the same append-only log.
+func VerifyFork(operator ed25519.PublicKey, f *Fork) error {
+	if f == nil || f.Local == nil || f.Remote == nil {
+		return fmt.Errorf("missing tree head")
+	}
+	for _, th := range []*TreeHead{f.Local, f.Remote} {
+		if err := VerifyTreeHead(operator, th); err != nil {
+			return err
+		}
+	}
+	if f.Local.Manifest != f.Remote.Manifest {
+		return fmt.Errorf("tree heads belong to different elections")
+	}
+	smaller, larger := f.Local, f.Remote
+	if smaller.Size > larger.Size {
+		smaller, larger = larger, smaller
+	}
+	if smaller.Size == larger.Size {
+		if smaller.Root == larger.Root {
+			return fmt.Errorf("tree heads of size %d agree", smaller.Size)
+		}
+		return nil
+	}
+	prefix := &TreeHead{Manifest: larger.Manifest, Size: smaller.Size, Root: f.Root}
+	if err := VerifyConsistency(prefix, larger, f.Proof); err != nil {
+		return fmt.Errorf("fork evidence: %w", err)
+	}
+	if f.Root == smaller.Root {
+		return fmt.Errorf("tree head of size %d is a prefix of size %d", smaller.Size, larger.Size)
+	}
+	return nil
+}
+
+// Replica keeps a copy of the operator's board and gossips with other
+// replicas. The primary replica wraps the board the operator appends to;
+// mirrors wrap their own local log and only ever append entries that
+// extend an operator tree head they have verified.
+type Replica struct {
+	// OnFork, if set, is called with the evidence whenever a fork is found.
+	OnFork func(Fork)
+
+	mu       sync.Mutex
+	board    *Board
+	operator ed25519.PublicKey
+	t        Transport
+	latest   *TreeHead // Latest verified operator head, for mirrors
+}
+
+// NewReplica returns a replica of the board signed by operator, storing its
+// copy in local and reaching peers through t. If local is signed by the
+// operator key itself, the replica is the primary.
+func NewReplica(local *Board, operator ed25519.PublicKey, t Transport) (*Replica, error) {
+	if len(operator) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid operator key")
+	}
+	if local == nil || t == nil {
+		return nil, fmt.Errorf("replica needs a local board and a transport")
+	}
+	return &Replica{board: local, operator: operator, t: t}, nil
+}
+
+// Head returns the latest operator tree head the replica vouches for, or
+// nil if a mirror has not synchronized yet.
+func (r *Replica) Head() (*TreeHead, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.head()
+}
+
+// Handle serves a replication request from a peer.
+func (r *Replica) Handle(req *Message) (*Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch req.Type {
+	case MsgHead:
+		th, err := r.head()
+		if err != nil {
+			return nil, err
+		}
+		return &Message{Type: MsgHead, Head: th}, nil
+	case MsgConsistency:
+		r.board.mu.Lock()
+		root, err := r.board.tree.RootAt(req.First)
+		var proof []merkle.Hash
+		if err == nil {
+			proof, err = r.board.tree.ConsistencyProof(req.First, req.Second)
+		}
+		r.board.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		return &Message{Type: MsgConsistency, First: req.First, Second: req.Second, Root: &root, Proof: proof}, nil
+	case MsgEntries:
+		size := r.board.Size()
+		if req.First > req.Second || req.Second > size {
+			return nil, fmt.Errorf("entries [%d, %d) outside board of %d entries", req.First, req.Second, size)
+		}
+		second := min(req.Second, req.First+maxBatch)
+		r.board.mu.Lock()
+		entries := r.board.entries[req.First:second]
+		r.board.mu.Unlock()
+		return &Message{Type: MsgEntries, First: req.First, Second: second, Entries: entries}, nil
+	default:
+		return nil, fmt.Errorf("unknown message type %q", req.Type)
+	}
+}
+
+// Gossip fetches the latest head of peer and reconciles it with the local
+// copy. A head that extends the local log is adopted after checking its
+// consistency proof and copying the missing entries. A fork alarm is
+// raised, and ErrFork returned, only on evidence that VerifyFork accepts; a
+// peer serving a bad proof or bad entries gets a plain error, as it may
+// simply be faulty.
+//
+// No lock is held while talking to the peer, so replicas can gossip with
+// each other concurrently.
+func (r *Replica) Gossip(peer string) error {
+	resp, err := r.t.Call(peer, &Message{Type: MsgHead})
+	if err != nil {
+		return err
+	}
+	remote := resp.Head
+	if remote == nil {
+		return nil // The peer has nothing to vouch for yet
+	}
+	if err := VerifyTreeHead(r.operator, remote); err != nil {
+		return fmt.Errorf("peer %q: %w", peer, err)
+	}
+	if remote.Manifest != r.board.manifest {
+		return fmt.Errorf("peer %q replicates another election", peer)
+	}
+
+	r.mu.Lock()
+	local, err := r.head()
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	r.board.mu.Lock()
+	size := r.board.tree.Size()
+	tree := r.board.tree.Clone()
+	r.board.mu.Unlock()
+
+	if remote.Size <= size {
+		root, err := tree.RootAt(remote.Size)
+		if err != nil {
+			return err
+		}
+		if root == remote.Root {
+			return nil
+		}
+		// Only a signed head covering remote.Size turns the mismatch into
+		// evidence; a restarted mirror has none yet.
+		if local == nil || local.Size < remote.Size {
+			return fmt.Errorf("peer %q: head of size %d differs from the local log, which has no operator head covering it", peer, remote.Size)
+		}
+		proof, err := tree.ConsistencyProof(remote.Size, local.Size)
+		if err != nil {
+			return err
+		}
+		return r.fork(Fork{Peer: peer, Local: local, Remote: remote, Root: root, Proof: proof,
+			Reason: fmt.Sprintf("different logs at size %d", remote.Size)})
+	}
+
+	// Check that the remote head extends ours before copying anything. The
+	// peer returns its root at our size, so a divergence comes with proof.
+	if local != nil {
+		resp, err := r.t.Call(peer, &Message{Type: MsgConsistency, First: local.Size, Second: remote.Size})
+		if err != nil {
+			return err
+		}
+		if resp.Root == nil {
+			return fmt.Errorf("peer %q: consistency response without a root", peer)
+		}
+		if err := merkle.VerifyConsistency(local.Size, remote.Size, *resp.Root, remote.Root, resp.Proof); err != nil {
+			return fmt.Errorf("peer %q: %w", peer, err)
+		}
+		if *resp.Root != local.Root {
+			return r.fork(Fork{Peer: peer, Local: local, Remote: remote, Root: *resp.Root, Proof: resp.Proof,
+				Reason: fmt.Sprintf("different logs at size %d", local.Size)})
+		}
+	}
+	if r.primary() {
+		return fmt.Errorf("peer %q: operator head of size %d beyond the primary log of %d", peer, remote.Size, size)
+	}
+
+	var missing [][]byte
+	for next := size; next < remote.Size; {
+		resp, err := r.t.Call(peer, &Message{Type: MsgEntries, First: next, Second: remote.Size})
+		if err != nil {
+			return err
+		}
+		if resp.First != next || len(resp.Entries) == 0 || uint64(len(resp.Entries)) > remote.Size-next {
+			return fmt.Errorf("peer %q: malformed entries response", peer)
+		}
+		for i, data := range resp.Entries {
+			if _, err := r.board.decode(data); err != nil {
+				return fmt.Errorf("peer %q: entry %d: %w", peer, next+uint64(i), err)
+			}
+			tree.Append(data)
+		}
+		missing = append(missing, resp.Entries...)
+		next += uint64(len(resp.Entries))
+	}
+	if tree.Root() != remote.Root {
+		return fmt.Errorf("peer %q served entries that do not match its tree head", peer)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.board.mu.Lock()
+	defer r.board.mu.Unlock()
+	if r.board.tree.Size() != size {
+		return fmt.Errorf("local log changed during gossip with %q, retry", peer)
+	}
+	if len(missing) > 0 {
+		if _, err := r.board.appendEntries(missing...); err != nil {
+			return err
+		}
+	}
+	r.latest = remote
+	return nil
+}
+
+// head returns the head the replica vouches for: a fresh operator head on
+// the primary, the latest verified one on mirrors.
+func (r *Replica) head() (*TreeHead, error) {
+	if r.primary() {
+		return r.board.TreeHead()
+	}
+	return r.latest, nil
+}
+
+// primary reports whether the local board is the operator's own.
+func (r *Replica) primary() bool {
+	return r.board.PublicKey().Equal(r.operator)
+}
+
+// fork raises the alarm and returns the matching error.
+func (r *Replica) fork(f Fork) error {
+	if r.OnFork != nil {
+		r.OnFork(f)
+	}
+	return fmt.Errorf("%w: peer %q: %s", ErrFork, f.Peer, f.Reason)
+}
@@ -0,0 +1,215 @@
+package board
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/p4u/m1fp-go/m1fp"
+	"github.com/p4u/m1fp-go/manifest"
+	"github.com/p4u/m1fp-go/merkle"
+)
+
+// mirror opens a fresh local log with its own key and registers a replica
+// of the operator board under name.
+func mirror(t *testing.T, tr *MemoryTransport, name string, operator ed25519.PublicKey, pk *m1fp.PublicKey) *Replica {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	local, err := Open(filepath.Join(t.TempDir(), name+".log"), manifest.Hash{1}, pk, key)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { local.Close() })
+	r, err := NewReplica(local, operator, tr)
+	if err != nil {
+		t.Fatalf("NewReplica failed: %v", err)
+	}
+	tr.Register(name, r.Handle)
+	return r
+}
+
+func appendVotes(t *testing.T, b *Board, pk *m1fp.PublicKey, votes ...uint64) {
+	t.Helper()
+	for _, v := range votes {
+		ct, _, err := m1fp.EncryptVote(pk, v, nil)
+		if err != nil {
+			t.Fatalf("EncryptVote failed: %v", err)
+		}
+		if _, err := b.Append(ct); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+}
+
+func TestReplicationFollowsOperator(t *testing.T) {
+	sk, pk, err := m1fp.KeyGen(256, m1fp.X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+	b, _, _ := testBoard(t, pk)
+	defer b.Close()
+	tr := NewMemoryTransport()
+	primary, err := NewReplica(b, b.PublicKey(), tr)
+	if err != nil {
+		t.Fatalf("NewReplica failed: %v", err)
+	}
+	tr.Register("primary", primary.Handle)
+	m1 := mirror(t, tr, "m1", b.PublicKey(), pk)
+	m2 := mirror(t, tr, "m2", b.PublicKey(), pk)
+
+	appendVotes(t, b, pk, 1, 2, 3)
+	if err := m1.Gossip("primary"); err != nil {
+		t.Fatalf("m1 gossip with primary failed: %v", err)
+	}
+	old, _ := m1.Head()
+
+	appendVotes(t, b, pk, 4, 5)
+	if err := m1.Gossip("primary"); err != nil {
+		t.Fatalf("m1 gossip with primary failed: %v", err)
+	}
+	if err := m2.Gossip("m1"); err != nil {
+		t.Fatalf("m2 gossip with m1 failed: %v", err)
+	}
+	if err := primary.Gossip("m2"); err != nil {
+		t.Fatalf("primary gossip with m2 failed: %v", err)
+	}
+
+	head, _ := m2.Head()
+	if head == nil || head.Size != 5 {
+		t.Fatalf("m2 did not catch up with the operator: %+v", head)
+	}
+	proof, err := b.ConsistencyProof(old.Size, head.Size)
+	if err != nil {
+		t.Fatalf("ConsistencyProof failed: %v", err)
+	}
+	if err := VerifyConsistency(old, head, proof); err != nil {
+		t.Fatalf("consistent tree heads rejected: %v", err)
+	}
+
+	sum, err := m2.board.Tally(pk.Prec)
+	if err != nil {
+		t.Fatalf("Tally failed: %v", err)
+	}
+	if got, err := m1fp.DecryptVote(sk, sum); err != nil || got != 15 {
+		t.Fatalf("mirror tally decrypts to %d (%v), want 15", got, err)
+	}
+}
+
+func TestReplicationDetectsFork(t *testing.T) {
+	_, pk, err := m1fp.KeyGen(256, m1fp.X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+	honest, _, key := testBoard(t, pk)
+	defer honest.Close()
+	// The operator runs a second board with the same key and shows it to
+	// part of the observers.
+	evil, err := Open(filepath.Join(t.TempDir(), "evil.log"), manifest.Hash{1}, pk, key)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer evil.Close()
+
+	tr := NewMemoryTransport()
+	for name, b := range map[string]*Board{"honest": honest, "evil": evil} {
+		r, err := NewReplica(b, b.PublicKey(), tr)
+		if err != nil {
+			t.Fatalf("NewReplica failed: %v", err)
+		}
+		tr.Register(name, r.Handle)
+	}
+	a := mirror(t, tr, "a", honest.PublicKey(), pk)
+	c := mirror(t, tr, "c", honest.PublicKey(), pk)
+
+	appendVotes(t, honest, pk, 1, 1, 0)
+	appendVotes(t, evil, pk, 1, 0)
+	if err := a.Gossip("honest"); err != nil {
+		t.Fatalf("a gossip failed: %v", err)
+	}
+	if err := c.Gossip("evil"); err != nil {
+		t.Fatalf("c gossip failed: %v", err)
+	}
+
+	var alarms []Fork
+	a.OnFork = func(f Fork) { alarms = append(alarms, f) }
+	if err := a.Gossip("c"); !errors.Is(err, ErrFork) {
+		t.Fatalf("gossip with forked replica: got %v, want ErrFork", err)
+	}
+	if len(alarms) != 1 || alarms[0].Peer != "c" {
+		t.Fatalf("fork alarm not raised: %+v", alarms)
+	}
+	if err := VerifyFork(honest.PublicKey(), &alarms[0]); err != nil {
+		t.Fatalf("fork evidence rejected: %v", err)
+	}
+
+	// The smaller forked replica learns about the fork from the larger one.
+	c.OnFork = func(f Fork) { alarms = append(alarms, f) }
+	if err := c.Gossip("a"); !errors.Is(err, ErrFork) {
+		t.Fatalf("gossip from forked replica: got %v, want ErrFork", err)
+	}
+	if len(alarms) != 2 {
+		t.Fatalf("fork alarm not raised: %+v", alarms)
+	}
+	if err := VerifyFork(honest.PublicKey(), &alarms[1]); err != nil {
+		t.Fatalf("fork evidence rejected: %v", err)
+	}
+
+	// Two heads of one log are no evidence, whatever the reason claims.
+	head, _ := a.Head()
+	older := *alarms[1].Remote
+	older.Size, older.Root = 2, alarms[1].Root
+	if err := VerifyFork(honest.PublicKey(), &Fork{Local: head, Remote: head}); err == nil {
+		t.Fatalf("identical tree heads accepted as a fork")
+	}
+	if err := VerifyFork(honest.PublicKey(), &Fork{Local: &older, Remote: head, Root: older.Root, Proof: alarms[1].Proof}); err == nil {
+		t.Fatalf("unsigned tree head accepted as a fork")
+	}
+}
+
+func TestReplicationBadProofIsNotFork(t *testing.T) {
+	_, pk, err := m1fp.KeyGen(256, m1fp.X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+	b, _, _ := testBoard(t, pk)
+	defer b.Close()
+	tr := NewMemoryTransport()
+	primary, err := NewReplica(b, b.PublicKey(), tr)
+	if err != nil {
+		t.Fatalf("NewReplica failed: %v", err)
+	}
+	tr.Register("primary", primary.Handle)
+	m := mirror(t, tr, "m", b.PublicKey(), pk)
+
+	appendVotes(t, b, pk, 1, 2)
+	if err := m.Gossip("primary"); err != nil {
+		t.Fatalf("m gossip with primary failed: %v", err)
+	}
+	appendVotes(t, b, pk, 3)
+
+	// A faulty peer relays the operator's head with a garbage proof.
+	tr.Register("liar", func(req *Message) (*Message, error) {
+		resp, err := primary.Handle(req)
+		if err == nil && req.Type == MsgConsistency {
+			resp.Root = &merkle.Hash{1}
+			resp.Proof = []merkle.Hash{{2}, {3}}
+		}
+		return resp, err
+	})
+	var alarms []Fork
+	m.OnFork = func(f Fork) { alarms = append(alarms, f) }
+	if err := m.Gossip("liar"); err == nil || errors.Is(err, ErrFork) {
+		t.Fatalf("gossip with faulty peer: got %v, want a plain error", err)
+	}
+	if len(alarms) != 0 {
+		t.Fatalf("faulty peer raised a fork alarm: %+v", alarms)
+	}
+	if err := m.Gossip("primary"); err != nil {
+		t.Fatalf("m gossip with primary failed: %v", err)
+	}
+}
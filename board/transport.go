@@ -0,0 +1,87 @@
+package board
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/p4u/m1fp-go/merkle"
+)
+
+// Message types exchanged between replicas.
+const (
+	MsgHead        = "head"        // Request the latest tree head of the peer
+	MsgConsistency = "consistency" // Request a consistency proof from First to Second
+	MsgEntries     = "entries"     // Request the entries in [First, Second)
+)
+
+// Message is a request or response of the replication protocol.
+type Message struct {
+	Type    string        `json:"type"`
+	Head    *TreeHead     `json:"head,omitempty"`
+	First   uint64        `json:"first,omitempty"`
+	Second  uint64        `json:"second,omitempty"`
+	Entries [][]byte      `json:"entries,omitempty"`
+	Root    *merkle.Hash  `json:"root,omitempty"` // Root at First, with consistency proofs
+	Proof   []merkle.Hash `json:"proof,omitempty"`
+}
+
+// Transport carries replication requests to named peers.
+type Transport interface {
+	// Call sends req to peer and returns its response.
+	Call(peer string, req *Message) (*Message, error)
+}
+
+// Handler serves replication requests, typically Replica.Handle.
+type Handler func(req *Message) (*Message, error)
+
+// MemoryTransport connects replicas living in the same process. Messages
+// are encoded to JSON and back on every call, as they would on the wire.
+type MemoryTransport struct {
+	mu    sync.RWMutex
+	peers map[string]Handler
+}
+
+// NewMemoryTransport returns a transport with no peers.
+func NewMemoryTransport() *MemoryTransport {
+	return &MemoryTransport{peers: make(map[string]Handler)}
+}
+
+// Register makes h reachable as peer.
+func (t *MemoryTransport) Register(peer string, h Handler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.peers[peer] = h
+}
+
+// Call implements Transport.
+func (t *MemoryTransport) Call(peer string, req *Message) (*Message, error) {
+	t.mu.RLock()
+	h, ok := t.peers[peer]
+	t.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown peer %q", peer)
+	}
+	in, err := roundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := h(in)
+	if err != nil {
+		return nil, fmt.Errorf("peer %q: %w", peer, err)
+	}
+	return roundTrip(resp)
+}
+
+// roundTrip encodes m to JSON and decodes it into a fresh message.
+func roundTrip(m *Message) (*Message, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	out := new(Message)
+	if err := json.Unmarshal(data, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,166 @@
+// Package canonical implements the JSON Canonicalization Scheme (JCS) of
+// RFC 8785, the encoding that manifests are hashed and results are signed
+// in.
+//
+// A value is first encoded with encoding/json, so struct tags and
+// MarshalJSON/MarshalText methods apply as usual, and the result is then
+// rewritten in canonical form:
+//
+//   - no whitespace between tokens;
+//   - object members sorted by their names compared as arrays of UTF-16
+//     code units, with duplicate names rejected;
+//   - strings written as UTF-8, escaping only '"', '\\' and the control
+//     characters below U+0020: \b, \t, \n, \f and \r in their short form,
+//     the others as \u00xx with lowercase hex digits;
+//   - numbers written as ECMAScript would. Only integers in the I-JSON range
+//     [-(2^53-1), 2^53-1] are supported, which ECMAScript writes as plain
+//     decimal integers without leading zeros or a minus sign on zero; any
+//     other number is rejected rather than rounded.
+//
+// The documents of this module contain no other numbers.
+package canonical
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"unicode/utf16"
+)
+
+// maxSafeInteger is 2^53 - 1, the largest integer every JSON parser holding
+// numbers as IEEE 754 doubles reads back exactly.
+const maxSafeInteger = 1<<53 - 1
+
+// Marshal returns the RFC 8785 canonical JSON encoding of v.
+func Marshal(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return Transform(data)
+}
+
+// Transform rewrites the JSON document data in canonical form.
+func Transform(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var buf bytes.Buffer
+	if err := transform(&buf, dec); err != nil {
+		return nil, fmt.Errorf("canonical json: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("canonical json: trailing data")
+	}
+	return buf.Bytes(), nil
+}
+
+// member is an object member with its name encoded as UTF-16, the order
+// RFC 8785 sorts by.
+type member struct {
+	key   []uint16
+	name  string
+	value []byte
+}
+
+// transform writes the next JSON value read from dec to buf.
+func transform(buf *bytes.Buffer, dec *json.Decoder) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch tok := tok.(type) {
+	case json.Delim:
+		switch tok {
+		case '[':
+			buf.WriteByte('[')
+			for i := 0; dec.More(); i++ {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				if err := transform(buf, dec); err != nil {
+					return err
+				}
+			}
+			buf.WriteByte(']')
+		case '{':
+			var members []member
+			for dec.More() {
+				tok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				name := tok.(string)
+				var value bytes.Buffer
+				if err := transform(&value, dec); err != nil {
+					return err
+				}
+				members = append(members, member{key: utf16.Encode([]rune(name)), name: name, value: value.Bytes()})
+			}
+			slices.SortFunc(members, func(a, b member) int { return slices.Compare(a.key, b.key) })
+			buf.WriteByte('{')
+			for i, m := range members {
+				if i > 0 {
+					if slices.Equal(members[i-1].key, m.key) {
+						return fmt.Errorf("duplicate member %q", m.name)
+					}
+					buf.WriteByte(',')
+				}
+				writeString(buf, m.name)
+				buf.WriteByte(':')
+				buf.Write(m.value)
+			}
+			buf.WriteByte('}')
+		}
+		if _, err := dec.Token(); err != nil { // Closing delimiter
+			return err
+		}
+	case string:
+		writeString(buf, tok)
+	case json.Number:
+		n, err := strconv.ParseInt(string(tok), 10, 64)
+		if err != nil || n < -maxSafeInteger || n > maxSafeInteger {
+			return fmt.Errorf("unsupported number %s", tok)
+		}
+		buf.WriteString(strconv.FormatInt(n, 10))
+	case bool:
+		buf.WriteString(strconv.FormatBool(tok))
+	case nil:
+		buf.WriteString("null")
+	}
+	return nil
+}
+
+// writeString writes s as a JSON string with the escaping of RFC 8785.
+func writeString(buf *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\r':
+			buf.WriteString(`\r`)
+		default:
+			if r < 0x20 {
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[r>>4])
+				buf.WriteByte(hex[r&0xf])
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
@@ -0,0 +1,70 @@
+package canonical
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTransformKnownAnswers(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		// RFC 8785, section 3.2.3: sorting by UTF-16 code units.
+		{
+			`{"\u20ac": "Euro Sign", "\r": "Carriage Return", "\ufb33": "Hebrew Letter Dalet With Dagesh",
+			  "1": "One", "\ud83d\ude00": "Emoji: Grinning Face", "\u0080": "Control", "\u00f6": "Latin Small Letter O With Diaeresis"}`,
+			"{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\",\"\u00f6\":\"Latin Small Letter O With Diaeresis\"," +
+				"\"\u20ac\":\"Euro Sign\",\"\U0001f600\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}",
+		},
+		// RFC 8785, section 3.2.2.2: string escaping.
+		{`"\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/"`, "\"\u20ac$\\u000f\\nA'B\\\"\\\\\\\\\\\"/\""},
+		// Nesting, literals and integers.
+		{
+			` { "b" : [ 3 , -0 , 9007199254740991 , null , true ] , "a" : { "z" : false , "y" : "" } } `,
+			`{"a":{"y":"","z":false},"b":[3,0,9007199254740991,null,true]}`,
+		},
+		{`"\u0000\u001f\b\f\t"`, `"\u0000\u001f\b\f\t"`},
+		{`[]`, `[]`},
+		{`{}`, `{}`},
+	} {
+		got, err := Transform([]byte(tc.in))
+		if err != nil {
+			t.Fatalf("Transform(%s) failed: %v", tc.in, err)
+		}
+		if string(got) != tc.want {
+			t.Fatalf("Transform(%s) = %s, want %s", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestTransformRejects(t *testing.T) {
+	for _, in := range []string{
+		`1.5`,
+		`1e3`,
+		`9007199254740992`,
+		`-9007199254740992`,
+		`{"a":1,"a":2}`,
+		`{"a":1} {}`,
+		`[1,`,
+	} {
+		if _, err := Transform([]byte(in)); err == nil {
+			t.Fatalf("Transform(%s) accepted", in)
+		}
+	}
+}
+
+func TestMarshalUsesJSONTags(t *testing.T) {
+	v := struct {
+		Zeta  string `json:"zeta"`
+		Alpha []byte `json:"alpha"`
+		Skip  int    `json:"skip,omitempty"`
+	}{Zeta: "<&>", Alpha: []byte{1, 2, 3}}
+	got, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if want := `{"alpha":"AQID","zeta":"<&>"}`; string(got) != want {
+		t.Fatalf("Marshal = %s, want %s", got, want)
+	}
+	if strings.Contains(string(got), `\u003c`) {
+		t.Fatalf("Marshal escapes HTML")
+	}
+}
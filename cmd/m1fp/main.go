@@ -0,0 +1,89 @@
+// Command m1fp runs election tools on top of the m1fp packages.
+//
+// Usage:
+//
+//	m1fp verify-election <record-dir>
+//	m1fp simulate [flags]
+//
+// verify-election checks the election record in a directory written by
+// package record: every ballot proof, the board tree head, the homomorphic
+// tally recomputed with AddMany and the decryption proofs of the results.
+// It prints one line per discrepancy and exits with status 1 if there is
+// any, or 2 if the record cannot be read.
+//
+// simulate generates synthetic voters with a configurable vote distribution
+// and ballot mode, then encrypts, aggregates and decrypts their ballots. It
+// reports the throughput and memory use of every phase and exits with
+// status 1 if the decrypted tally differs from the plaintext one. Votes and
+// ballot randomness derive from -seed; the election key is fresh every run.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/p4u/m1fp-go/record"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command line args and returns the exit status.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+	switch args[0] {
+	case "verify-election":
+		return verifyElection(args[1:], stdout, stderr)
+	case "simulate":
+		return simulate(args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		usage(stdout)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "m1fp: unknown command %q\n", args[0])
+		usage(stderr)
+		return 2
+	}
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: m1fp <command> [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	fmt.Fprintln(w, "  verify-election <record-dir>   verify an election record")
+	fmt.Fprintln(w, "  simulate [flags]               run a synthetic election; -h lists the flags")
+}
+
+func verifyElection(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("verify-election", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(stderr, "usage: m1fp verify-election <record-dir>")
+		return 2
+	}
+
+	rep, err := record.Verify(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "m1fp: %v\n", err)
+		return 2
+	}
+	fmt.Fprintf(stdout, "election %s: %d ballots, %d board entries\n", rep.Manifest, rep.Ballots, rep.Entries)
+	for _, f := range rep.Findings {
+		fmt.Fprintf(stdout, "FAIL %s\n", f)
+	}
+	if !rep.OK() {
+		fmt.Fprintf(stdout, "%d discrepancies found\n", len(rep.Findings))
+		return 1
+	}
+	fmt.Fprintln(stdout, "OK")
+	return 0
+}
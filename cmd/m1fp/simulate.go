@@ -0,0 +1,478 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"math/rand/v2"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/p4u/m1fp-go/m1fp"
+)
+
+// Ballot modes of the simulator besides those of m1fp.BallotSpec.
+const (
+	modeBorda     m1fp.BallotMode = "borda"
+	modeCondorcet m1fp.BallotMode = "condorcet"
+)
+
+// simContext binds the proofs of simulated ballots.
+var simContext = []byte("m1fp/simulate")
+
+// simConfig holds the parameters of a simulation.
+type simConfig struct {
+	voters   int
+	mode     m1fp.BallotMode
+	options  int
+	weights  []float64 // Relative popularity of every option
+	dist     string
+	maxScore uint64
+	budget   uint64
+	seed     uint64
+	workers  int
+	proofs   bool // Encrypt non-ranked ballots with validity proofs
+	verify   bool // Verify every ballot proof in a phase of its own
+}
+
+// voter is one simulated voter: the plaintext contribution to every result
+// count, the counters added to the tally and, when proofs are verified, the
+// ballot.
+type voter struct {
+	counts   []uint64
+	counters []*m1fp.Ciphertext
+	ballot   any
+}
+
+// phase is the measurement of one simulation phase.
+type phase struct {
+	name     string
+	elapsed  time.Duration
+	items    int
+	alloc    uint64 // Bytes allocated during the phase
+	heapLive uint64 // Live heap at the end of the phase
+}
+
+func simulate(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	cfg := simConfig{}
+	var mode string
+	fs.IntVar(&cfg.voters, "voters", 1000, "number of synthetic voters")
+	fs.StringVar(&mode, "mode", "plurality", "ballot mode: plurality, approval, score, cumulative, borda or condorcet")
+	fs.IntVar(&cfg.options, "options", 4, "number of options")
+	fs.StringVar(&cfg.dist, "dist", "uniform", `vote distribution: "uniform", "zipf" or comma-separated option weights`)
+	fs.Uint64Var(&cfg.maxScore, "max-score", 5, "highest score per option in score mode")
+	fs.Uint64Var(&cfg.budget, "budget", 10, "points per voter in cumulative mode")
+	fs.Uint64Var(&cfg.seed, "seed", 1, "seed of votes and ballot randomness")
+	fs.IntVar(&cfg.workers, "workers", runtime.GOMAXPROCS(0), "encryption, verification and aggregation goroutines")
+	fs.BoolVar(&cfg.proofs, "proofs", true, "attach validity proofs to non-ranked ballots; ranked ballots always carry them")
+	fs.BoolVar(&cfg.verify, "verify", false, "verify every ballot proof")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	cfg.mode = m1fp.BallotMode(mode)
+	if err := cfg.check(); err != nil {
+		fmt.Fprintf(stderr, "m1fp simulate: %v\n", err)
+		return 2
+	}
+	ok, err := cfg.run(stdout)
+	if err != nil {
+		fmt.Fprintf(stderr, "m1fp simulate: %v\n", err)
+		return 2
+	}
+	if !ok {
+		return 1
+	}
+	return 0
+}
+
+// check validates the configuration and resolves the distribution.
+func (c *simConfig) check() error {
+	if c.voters < 1 || c.options < 2 || c.workers < 1 {
+		return fmt.Errorf("need at least one voter, two options and one worker")
+	}
+	if c.mode == modeBorda || c.mode == modeCondorcet {
+		c.proofs = true
+	} else if err := c.spec().Validate(); err != nil {
+		return err
+	}
+	if c.verify && !c.proofs {
+		return fmt.Errorf("-verify needs -proofs")
+	}
+	var err error
+	c.weights, err = parseDistribution(c.dist, c.options)
+	return err
+}
+
+// spec returns the ballot spec of a non-ranked mode.
+func (c *simConfig) spec() m1fp.BallotSpec {
+	return m1fp.BallotSpec{
+		Mode:        c.mode,
+		Options:     c.options,
+		MaxScore:    c.maxScore,
+		Budget:      c.budget,
+		ExactBudget: true,
+		Context:     simContext,
+	}
+}
+
+// resultSize returns the number of result counts, as in manifest.Question.
+func (c *simConfig) resultSize() int {
+	if c.mode == modeCondorcet {
+		return c.options * c.options
+	}
+	return c.options
+}
+
+// parseDistribution returns the option weights described by s.
+func parseDistribution(s string, k int) ([]float64, error) {
+	w := make([]float64, k)
+	switch s {
+	case "uniform":
+		for i := range w {
+			w[i] = 1
+		}
+		return w, nil
+	case "zipf":
+		for i := range w {
+			w[i] = 1 / float64(i+1)
+		}
+		return w, nil
+	}
+	fields := strings.Split(s, ",")
+	if len(fields) != k {
+		return nil, fmt.Errorf("distribution has %d weights for %d options", len(fields), k)
+	}
+	var total float64
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil || v < 0 {
+			return nil, fmt.Errorf("invalid weight %q", f)
+		}
+		w[i] = v
+		total += v
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("distribution has no positive weight")
+	}
+	return w, nil
+}
+
+// run executes the simulation, prints its report and returns whether the
+// decrypted tally agrees with the plaintext one.
+func (c *simConfig) run(w io.Writer) (bool, error) {
+	fmt.Fprintf(w, "simulate: %d voters, %s over %d options, distribution %s, seed %d, %d workers\n",
+		c.voters, c.mode, c.options, c.dist, c.seed, c.workers)
+
+	var phases []phase
+	measure := func(name string, items int, fn func() error) error {
+		runtime.GC()
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		start := time.Now()
+		if err := fn(); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		elapsed := time.Since(start)
+		runtime.ReadMemStats(&after)
+		phases = append(phases, phase{
+			name:     name,
+			elapsed:  elapsed,
+			items:    items,
+			alloc:    after.TotalAlloc - before.TotalAlloc,
+			heapLive: after.HeapAlloc,
+		})
+		return nil
+	}
+
+	var sk *m1fp.PrivateKey
+	var pk *m1fp.PublicKey
+	if err := measure("keygen", 1, func() (err error) {
+		sk, pk, err = m1fp.KeyGen(256, m1fp.X)
+		return err
+	}); err != nil {
+		return false, err
+	}
+
+	voters := make([]voter, c.voters)
+	if err := measure("encrypt", c.voters, func() error {
+		return c.parallel(func(i int) error {
+			return c.castVote(pk, i, &voters[i])
+		})
+	}); err != nil {
+		return false, err
+	}
+
+	if c.verify {
+		if err := measure("verify", c.voters, func() error {
+			return c.parallel(func(i int) error {
+				return c.verifyBallot(pk, voters[i].ballot)
+			})
+		}); err != nil {
+			return false, err
+		}
+	}
+
+	size := c.resultSize()
+	aggregate := make([]*m1fp.Ciphertext, size)
+	if err := measure("aggregate", c.voters, func() error {
+		column := make([]*m1fp.Ciphertext, c.voters)
+		for j := range aggregate {
+			for i := range voters {
+				column[i] = voters[i].counters[j]
+			}
+			var err error
+			if aggregate[j], err = m1fp.AddManyContext(context.Background(), column, c.workers); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return false, err
+	}
+
+	got := make([]uint64, size)
+	if err := measure("decrypt", size, func() error {
+		for j, ct := range aggregate {
+			var err error
+			if got[j], err = m1fp.DecryptVote(sk, ct); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return false, err
+	}
+
+	want := make([]uint64, size)
+	for i := range voters {
+		for j, v := range voters[i].counts {
+			want[j] += v
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "phase\ttime\titems/s\tallocated\tlive heap\t")
+	for _, p := range phases {
+		rate := float64(p.items) / p.elapsed.Seconds()
+		fmt.Fprintf(tw, "%s\t%s\t%.1f\t%s\t%s\t\n", p.name, p.elapsed.Round(time.Microsecond), rate, mib(p.alloc), mib(p.heapLive))
+	}
+	tw.Flush()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	fmt.Fprintf(w, "memory obtained from the OS: %s\n", mib(ms.Sys))
+	fmt.Fprintf(w, "tally:    %v\nexpected: %v\n", got, want)
+	if !slices.Equal(got, want) {
+		fmt.Fprintln(w, "MISMATCH: decrypted tally differs from the plaintext tally")
+		return false, nil
+	}
+	fmt.Fprintln(w, "tallies agree")
+	return true, nil
+}
+
+// parallel calls fn for every voter index on c.workers goroutines and
+// returns the first error.
+func (c *simConfig) parallel(fn func(i int) error) error {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		first error
+		next  = make(chan int)
+	)
+	for range c.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if err := fn(i); err != nil {
+					mu.Lock()
+					if first == nil {
+						first = fmt.Errorf("voter %d: %w", i, err)
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range c.voters {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return first
+}
+
+// castVote draws the vote of voter i and encrypts it. Every voter has its
+// own generator seeded with the simulation seed and its index, so results
+// do not depend on the number of workers.
+func (c *simConfig) castVote(pk *m1fp.PublicKey, i int, v *voter) error {
+	var seed [32]byte
+	binary.BigEndian.PutUint64(seed[:8], c.seed)
+	binary.BigEndian.PutUint64(seed[8:16], uint64(i))
+	src := rand.NewChaCha8(seed)
+	rng := rand.New(src)
+
+	switch c.mode {
+	case modeBorda, modeCondorcet:
+		ranking := c.sampleRanking(rng)
+		pos := make([]int, c.options)
+		for p, cand := range ranking {
+			pos[cand] = p
+		}
+		if c.mode == modeBorda {
+			v.counts = make([]uint64, c.options)
+			for cand, p := range pos {
+				v.counts[cand] = uint64(c.options - 1 - p)
+			}
+			b, err := m1fp.EncryptBorda(pk, ranking, simContext, src)
+			if err != nil {
+				return err
+			}
+			v.ballot = b
+			v.counters, err = b.Scores()
+			return err
+		}
+		v.counts = make([]uint64, c.options*c.options)
+		for a := range c.options {
+			for b := range c.options {
+				if pos[a] < pos[b] {
+					v.counts[a*c.options+b] = 1
+				}
+			}
+		}
+		b, err := m1fp.EncryptCondorcet(pk, ranking, simContext, src)
+		if err != nil {
+			return err
+		}
+		v.ballot = b
+		for _, row := range b.Preferences {
+			v.counters = append(v.counters, row...)
+		}
+		return nil
+	}
+
+	v.counts = c.sampleValues(rng)
+	if c.proofs {
+		b, err := c.spec().Encrypt(pk, v.counts, src)
+		if err != nil {
+			return err
+		}
+		if c.verify {
+			v.ballot = b
+		}
+		v.counters = b.Entries
+		return nil
+	}
+	v.counters = make([]*m1fp.Ciphertext, c.options)
+	for j, value := range v.counts {
+		r := new(big.Int).SetUint64(rng.Uint64() | 1)
+		ct, _, err := m1fp.EncryptVote(pk, value, r)
+		if err != nil {
+			return err
+		}
+		v.counters[j] = ct
+	}
+	return nil
+}
+
+// verifyBallot checks the proofs of a simulated ballot.
+func (c *simConfig) verifyBallot(pk *m1fp.PublicKey, ballot any) error {
+	switch b := ballot.(type) {
+	case *m1fp.BordaBallot:
+		return m1fp.VerifyBorda(pk, c.options, simContext, b)
+	case *m1fp.CondorcetBallot:
+		return m1fp.VerifyCondorcet(pk, c.options, simContext, b)
+	case *m1fp.Ballot:
+		return c.spec().Verify(pk, b)
+	default:
+		return fmt.Errorf("no ballot to verify")
+	}
+}
+
+// sampleValues draws the entries of a non-ranked ballot. Plurality voters
+// pick one option with probability proportional to its weight; cumulative
+// voters spend each point that way. Approval voters approve every option
+// independently, the most popular one with probability 1/2 and the others
+// in proportion to their weight; score voters score each option as the
+// number of successes in max-score such draws.
+func (c *simConfig) sampleValues(rng *rand.Rand) []uint64 {
+	values := make([]uint64, c.options)
+	switch c.mode {
+	case m1fp.ModePlurality:
+		values[pick(rng, c.weights)] = 1
+	case m1fp.ModeCumulative:
+		for range c.budget {
+			values[pick(rng, c.weights)]++
+		}
+	case m1fp.ModeApproval, m1fp.ModeScore:
+		trials := uint64(1)
+		if c.mode == m1fp.ModeScore {
+			trials = c.maxScore
+		}
+		top := slices.Max(c.weights)
+		for j, w := range c.weights {
+			p := w / top / 2
+			for range trials {
+				if rng.Float64() < p {
+					values[j]++
+				}
+			}
+		}
+	}
+	return values
+}
+
+// sampleRanking draws a ranking option by option, each time picking among
+// the remaining options with probability proportional to their weight.
+func (c *simConfig) sampleRanking(rng *rand.Rand) []int {
+	remaining := make([]int, c.options)
+	for i := range remaining {
+		remaining[i] = i
+	}
+	ranking := make([]int, 0, c.options)
+	w := make([]float64, 0, c.options)
+	for len(remaining) > 0 {
+		w = w[:0]
+		for _, cand := range remaining {
+			w = append(w, c.weights[cand])
+		}
+		i := pick(rng, w)
+		ranking = append(ranking, remaining[i])
+		remaining = slices.Delete(remaining, i, i+1)
+	}
+	return ranking
+}
+
+// pick returns an index with probability proportional to its weight, or a
+// uniform one if all weights are zero.
+func pick(rng *rand.Rand, weights []float64) int {
+	var total float64
+	for _, w := range weights {
+		total += w
+	}
+	if total == 0 {
+		return rng.IntN(len(weights))
+	}
+	x := rng.Float64() * total
+	for i, w := range weights {
+		if x < w {
+			return i
+		}
+		x -= w
+	}
+	return len(weights) - 1
+}
+
+// mib formats a byte count in mebibytes.
+func mib(b uint64) string {
+	return fmt.Sprintf("%.1f MiB", float64(b)/(1<<20))
+}
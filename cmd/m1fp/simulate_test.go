@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSimulate(t *testing.T) {
+	for _, args := range [][]string{
+		{"-voters", "40", "-mode", "plurality", "-dist", "zipf", "-proofs=false"},
+		{"-voters", "8", "-mode", "cumulative", "-options", "3", "-budget", "4", "-dist", "5,3,0", "-verify"},
+		{"-voters", "4", "-mode", "condorcet", "-options", "3", "-verify", "-workers", "2"},
+	} {
+		var out, errOut bytes.Buffer
+		if code := run(append([]string{"simulate"}, args...), &out, &errOut); code != 0 {
+			t.Fatalf("simulate %v exited with %d:\n%s%s", args, code, out.String(), errOut.String())
+		}
+		if !strings.Contains(out.String(), "tallies agree") {
+			t.Fatalf("simulate %v did not report agreement:\n%s", args, out.String())
+		}
+	}
+}
+
+func TestSimulateIsReproducible(t *testing.T) {
+	tally := func(workers string) string {
+		var out, errOut bytes.Buffer
+		run([]string{"simulate", "-voters", "30", "-mode", "score", "-seed", "7", "-proofs=false", "-workers", workers}, &out, &errOut)
+		for _, line := range strings.Split(out.String(), "\n") {
+			if strings.HasPrefix(line, "expected:") {
+				return line
+			}
+		}
+		t.Fatalf("no expected tally in output:\n%s%s", out.String(), errOut.String())
+		return ""
+	}
+	if a, b := tally("1"), tally("4"); a != b {
+		t.Fatalf("same seed gave %q and %q", a, b)
+	}
+}
+
+func TestSimulateRejectsBadDistribution(t *testing.T) {
+	var out, errOut bytes.Buffer
+	if code := run([]string{"simulate", "-options", "3", "-dist", "1,2"}, &out, &errOut); code != 2 {
+		t.Fatalf("distribution with too few weights exited with %d", code)
+	}
+}
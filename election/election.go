@@ -0,0 +1,371 @@
+// Package election drives an m1fp election through its lifecycle:
+//
+//	setup → key ceremony → open → closed → tallying → published
+//
+// Every operation is only allowed in its own state: ballots are accepted
+// while the election is open, decryption starts only once it is closed, and
+// results are released only once published. The state is persisted to a
+// directory after every change, and the counters of every accepted ballot
+// are appended to a ballot log from which the running encrypted tallies are
+// rebuilt, so an election survives restarts.
+package election
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/p4u/m1fp-go/m1fp"
+	"github.com/p4u/m1fp-go/manifest"
+)
+
+// State is a stage of the election lifecycle.
+type State string
+
+const (
+	StateSetup       State = "setup"        // Manifest draft is recorded
+	StateKeyCeremony State = "key-ceremony" // Election key is being generated
+	StateOpen        State = "open"         // Ballots are accepted
+	StateClosed      State = "closed"       // No more ballots, tallies are final
+	StateTallying    State = "tallying"     // Tallies are being decrypted
+	StatePublished   State = "published"    // Results are public
+)
+
+// next lists the only transition allowed out of every state.
+var next = map[State]State{
+	StateSetup:       StateKeyCeremony,
+	StateKeyCeremony: StateOpen,
+	StateOpen:        StateClosed,
+	StateClosed:      StateTallying,
+	StateTallying:    StatePublished,
+}
+
+// ErrState is returned, wrapped, when an operation is not allowed in the
+// current state of the election.
+var ErrState = errors.New("operation not allowed in this election state")
+
+// Election is a persistent election. It is safe for concurrent use; ballot
+// proofs are verified without holding its lock.
+//
+// An election rejects a ballot whose counters were already tallied, which
+// stops a verbatim replay. It does not know who casts a ballot, so keeping
+// each voter to one ballot is the job of the caller, for example through an
+// eligibility.Gate.
+type Election struct {
+	mu      sync.Mutex
+	dir     string
+	rec     record
+	hash    manifest.Hash   // Manifest hash, set once the key is generated
+	pk      *m1fp.PublicKey // Election key, set once the key is generated
+	specs   map[string]m1fp.BallotSpec
+	tallies map[string]*m1fp.TallyVector
+	seen    map[ballotKey]bool // Ballots tallied so far
+	ballots *os.File           // Ballot log, open while ballots are accepted
+	err     error              // Set when the ballot log may not match the tallies
+}
+
+// record is the persisted state of an election.
+type record struct {
+	State    State              `json:"state"`
+	Manifest *manifest.Manifest `json:"manifest"`
+	Results  []*manifest.Result `json:"results,omitempty"`
+}
+
+// New creates an election in dir, which must not hold one already, from a
+// manifest draft. The draft carries everything but the public key, which is
+// filled in by the key ceremony.
+func New(dir string, draft *manifest.Manifest) (*Election, error) {
+	if draft == nil {
+		return nil, fmt.Errorf("nil manifest")
+	}
+	if draft.PublicKey != nil {
+		return nil, fmt.Errorf("manifest draft must not carry a public key")
+	}
+	e := &Election{dir: dir, rec: record{State: StateSetup, Manifest: draft}}
+	if err := e.create(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// State returns the current state.
+func (e *Election) State() State {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.rec.State
+}
+
+// Manifest returns the final manifest and its hash. It is available from the
+// end of the key ceremony on.
+func (e *Election) Manifest() (*manifest.Manifest, manifest.Hash, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.pk == nil {
+		return nil, manifest.Hash{}, fmt.Errorf("%w: manifest is final once the key is generated", ErrState)
+	}
+	return e.rec.Manifest, e.hash, nil
+}
+
+// BeginKeyCeremony freezes the manifest draft and moves to the key ceremony.
+func (e *Election) BeginKeyCeremony() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.advance(StateSetup)
+}
+
+// GenerateKey generates the election key with the parameters of the
+// manifest, stores the private key next to the state and completes the
+// manifest with the public key.
+func (e *Election) GenerateKey() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.require(StateKeyCeremony, "generate the key"); err != nil {
+		return err
+	}
+	if e.pk != nil {
+		return fmt.Errorf("election key already generated")
+	}
+	params := e.rec.Manifest.Parameters
+	sk, pk, err := m1fp.KeyGen(params.Precision, params.X)
+	if err != nil {
+		return err
+	}
+	pkBytes, err := pk.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	m := *e.rec.Manifest
+	m.PublicKey = pkBytes
+	if err := m.Validate(); err != nil {
+		return err
+	}
+	if err := e.saveKey(sk); err != nil {
+		return err
+	}
+	prev := e.rec.Manifest
+	e.rec.Manifest = &m
+	if err := e.load(); err != nil {
+		e.rec.Manifest = prev
+		return err
+	}
+	if err := e.save(); err != nil {
+		e.rec.Manifest, e.tallies, e.pk = prev, nil, nil
+		return err
+	}
+	return nil
+}
+
+// Open starts accepting ballots.
+func (e *Election) Open() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.pk == nil {
+		return fmt.Errorf("election key not generated")
+	}
+	if err := e.require(StateKeyCeremony, "move to "+string(StateOpen)); err != nil {
+		return err
+	}
+	if err := e.openBallots(); err != nil {
+		return err
+	}
+	if err := e.advance(StateKeyCeremony); err != nil {
+		e.closeBallots()
+		return err
+	}
+	return nil
+}
+
+// Cast verifies a ballot for a non-ranked question and adds it to the tally.
+func (e *Election) Cast(questionID string, b *m1fp.Ballot) error {
+	e.mu.Lock()
+	err := e.require(StateOpen, "cast ballots")
+	spec, ok := e.specs[questionID]
+	pk := e.pk
+	e.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("question %q does not take plain ballots", questionID)
+	}
+	if err := spec.Verify(pk, b); err != nil {
+		return fmt.Errorf("question %q: %w", questionID, err)
+	}
+	return e.tally(questionID, b.Entries)
+}
+
+// CastBorda verifies a Borda ballot and adds its scores to the tally.
+func (e *Election) CastBorda(questionID string, b *m1fp.BordaBallot) error {
+	q, pk, h, err := e.ranked(questionID, manifest.ModeBorda)
+	if err != nil {
+		return err
+	}
+	if err := m1fp.VerifyBorda(pk, len(q.Options), q.Context(h), b); err != nil {
+		return fmt.Errorf("question %q: %w", questionID, err)
+	}
+	scores, err := b.Scores()
+	if err != nil {
+		return err
+	}
+	return e.tally(questionID, scores)
+}
+
+// CastCondorcet verifies a Condorcet ballot and adds its preference matrix
+// to the tally.
+func (e *Election) CastCondorcet(questionID string, b *m1fp.CondorcetBallot) error {
+	q, pk, h, err := e.ranked(questionID, manifest.ModeCondorcet)
+	if err != nil {
+		return err
+	}
+	if err := m1fp.VerifyCondorcet(pk, len(q.Options), q.Context(h), b); err != nil {
+		return fmt.Errorf("question %q: %w", questionID, err)
+	}
+	var cells []*m1fp.Ciphertext
+	for _, row := range b.Preferences {
+		cells = append(cells, row...)
+	}
+	return e.tally(questionID, cells)
+}
+
+// Ballots returns the number of ballots tallied for a question.
+func (e *Election) Ballots(questionID string) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if tv, ok := e.tallies[questionID]; ok {
+		return tv.Ballots
+	}
+	return 0
+}
+
+// Close stops accepting ballots.
+func (e *Election) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.advance(StateOpen); err != nil {
+		return err
+	}
+	return e.closeBallots()
+}
+
+// Tally moves a closed election to tallying and decrypts every question.
+// If decryption is interrupted it can be retried in the tallying state.
+func (e *Election) Tally() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.rec.State == StateClosed {
+		if err := e.advance(StateClosed); err != nil {
+			return err
+		}
+	}
+	if err := e.require(StateTallying, "decrypt tallies"); err != nil {
+		return err
+	}
+	sk, err := e.loadKey()
+	if err != nil {
+		return err
+	}
+
+	m := e.rec.Manifest
+	results := make([]*manifest.Result, len(m.Questions))
+	for i, q := range m.Questions {
+		counts, err := e.tallies[q.ID].Decrypt(sk)
+		if err != nil {
+			return fmt.Errorf("question %q: %w", q.ID, err)
+		}
+		if results[i], err = m.NewResult(q.ID, counts); err != nil {
+			return err
+		}
+	}
+	e.rec.Results = results
+	return e.save()
+}
+
+// Publish releases the results computed by Tally.
+func (e *Election) Publish() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.rec.State == StateTallying && e.rec.Results == nil {
+		return fmt.Errorf("tallies not decrypted yet")
+	}
+	return e.advance(StateTallying)
+}
+
+// Results returns the published results, one per question in manifest order.
+func (e *Election) Results() ([]*manifest.Result, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.require(StatePublished, "read results"); err != nil {
+		return nil, err
+	}
+	return e.rec.Results, nil
+}
+
+// require fails unless the election is in state s.
+func (e *Election) require(s State, op string) error {
+	if e.rec.State != s {
+		return fmt.Errorf("%w: cannot %s while %s", ErrState, op, e.rec.State)
+	}
+	return nil
+}
+
+// advance moves from state from to its successor and persists the change.
+func (e *Election) advance(from State) error {
+	if err := e.require(from, "move to "+string(next[from])); err != nil {
+		return err
+	}
+	e.rec.State = next[from]
+	if err := e.save(); err != nil {
+		e.rec.State = from
+		return err
+	}
+	return nil
+}
+
+// ranked returns a ranked question of the given mode while ballots are
+// accepted, with the key and manifest hash its ballots are verified against.
+func (e *Election) ranked(questionID string, mode m1fp.BallotMode) (*manifest.Question, *m1fp.PublicKey, manifest.Hash, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.require(StateOpen, "cast ballots"); err != nil {
+		return nil, nil, manifest.Hash{}, err
+	}
+	q, err := e.rec.Manifest.Question(questionID)
+	if err != nil {
+		return nil, nil, manifest.Hash{}, err
+	}
+	if q.Mode != mode {
+		return nil, nil, manifest.Hash{}, fmt.Errorf("question %q does not take %s ballots", questionID, mode)
+	}
+	return q, e.pk, e.hash, nil
+}
+
+// tally adds the counters of one verified ballot to a question and appends
+// them to the ballot log. The in-memory tally is only replaced once the
+// ballot is on disk. The state is checked again, since the election may
+// have closed while the ballot was verified.
+func (e *Election) tally(questionID string, entries []*m1fp.Ciphertext) error {
+	key, err := keyOf(questionID, entries)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.require(StateOpen, "cast ballots"); err != nil {
+		return err
+	}
+	if e.seen[key] {
+		return fmt.Errorf("question %q: ballot already cast", questionID)
+	}
+	cur := e.tallies[questionID]
+	tv := &m1fp.TallyVector{Entries: cur.Entries, Ballots: cur.Ballots}
+	if err := tv.AddEntries(entries, e.pk.Prec); err != nil {
+		return fmt.Errorf("question %q: %w", questionID, err)
+	}
+	if err := e.logBallot(questionID, entries); err != nil {
+		return err
+	}
+	e.tallies[questionID] = tv
+	e.seen[key] = true
+	return nil
+}
@@ -0,0 +1,244 @@
+package election
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/p4u/m1fp-go/m1fp"
+	"github.com/p4u/m1fp-go/manifest"
+)
+
+func testDraft(t *testing.T) *manifest.Manifest {
+	t.Helper()
+	trusteeKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	return &manifest.Manifest{
+		Version:    manifest.Version,
+		ElectionID: "club-2026",
+		Title:      "Club elections",
+		Parameters: manifest.DefaultParameters(),
+		Trustees:   []manifest.Trustee{{ID: "board", Name: "Board", PublicKey: trusteeKey}},
+		Questions: []manifest.Question{
+			{ID: "chair", Title: "Chair", Options: []string{"Ada", "Bob", "Cy"}, Mode: m1fp.ModePlurality},
+			{ID: "venue", Title: "Venue", Options: []string{"Hall", "Park", "Pub"}, Mode: manifest.ModeBorda},
+		},
+	}
+}
+
+// openElection creates an election in a temporary directory and opens it.
+func openElection(t *testing.T) (*Election, string) {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "election")
+	e, err := New(dir, testDraft(t))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := e.BeginKeyCeremony(); err != nil {
+		t.Fatalf("BeginKeyCeremony failed: %v", err)
+	}
+	if err := e.GenerateKey(); err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	if err := e.Open(); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	return e, dir
+}
+
+func TestElectionLifecycle(t *testing.T) {
+	e, dir := openElection(t)
+	m, h, err := e.Manifest()
+	if err != nil {
+		t.Fatalf("Manifest failed: %v", err)
+	}
+	pk, err := m.Key()
+	if err != nil {
+		t.Fatalf("Key failed: %v", err)
+	}
+	chair, _ := m.Question("chair")
+	venue, _ := m.Question("venue")
+
+	info, err := os.Stat(filepath.Join(dir, keyFile))
+	if err != nil {
+		t.Fatalf("key file missing: %v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("key file mode %v, want 0600", info.Mode().Perm())
+	}
+
+	cast := func(e *Election, choice int, ranking []int) {
+		t.Helper()
+		spec, _ := chair.Spec(h)
+		values := make([]uint64, 3)
+		values[choice] = 1
+		b, err := spec.Encrypt(pk, values, rand.Reader)
+		if err != nil {
+			t.Fatalf("Encrypt failed: %v", err)
+		}
+		if err := e.Cast("chair", b); err != nil {
+			t.Fatalf("Cast failed: %v", err)
+		}
+		rb, err := m1fp.EncryptBorda(pk, ranking, venue.Context(h), rand.Reader)
+		if err != nil {
+			t.Fatalf("EncryptBorda failed: %v", err)
+		}
+		if err := e.CastBorda("venue", rb); err != nil {
+			t.Fatalf("CastBorda failed: %v", err)
+		}
+	}
+
+	cast(e, 0, []int{2, 0, 1})
+	cast(e, 2, []int{2, 1, 0})
+
+	// Restart in the middle of voting.
+	e, err = Load(dir)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if e.State() != StateOpen || e.Ballots("chair") != 2 {
+		t.Fatalf("reloaded election: state %s with %d ballots", e.State(), e.Ballots("chair"))
+	}
+	cast(e, 2, []int{0, 2, 1})
+
+	if err := e.Tally(); !errors.Is(err, ErrState) {
+		t.Fatalf("Tally before close: got %v, want ErrState", err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	spec, _ := chair.Spec(h)
+	late, err := spec.Encrypt(pk, []uint64{0, 1, 0}, rand.Reader)
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if err := e.Cast("chair", late); !errors.Is(err, ErrState) {
+		t.Fatalf("Cast after close: got %v, want ErrState", err)
+	}
+
+	if err := e.Tally(); err != nil {
+		t.Fatalf("Tally failed: %v", err)
+	}
+	if _, err := e.Results(); !errors.Is(err, ErrState) {
+		t.Fatalf("Results before publish: got %v, want ErrState", err)
+	}
+	if err := e.Publish(); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	e, err = Load(dir)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	results, err := e.Results()
+	if err != nil {
+		t.Fatalf("Results failed: %v", err)
+	}
+	if got := results[0].Counts; !slices.Equal(got, []uint64{1, 0, 2}) {
+		t.Fatalf("chair counts: got %v, want [1 0 2]", got)
+	}
+	if got := results[1].Counts; !slices.Equal(got, []uint64{3, 1, 5}) {
+		t.Fatalf("venue scores: got %v, want [3 1 5]", got)
+	}
+	for _, r := range results {
+		if err := m.CheckResult(r); err != nil {
+			t.Fatalf("result does not commit to the manifest: %v", err)
+		}
+	}
+}
+
+func TestElectionRejectsOutOfOrder(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "election")
+	e, err := New(dir, testDraft(t))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := e.Open(); err == nil {
+		t.Fatalf("Open accepted before the key ceremony")
+	}
+	if err := e.GenerateKey(); !errors.Is(err, ErrState) {
+		t.Fatalf("GenerateKey in setup: got %v, want ErrState", err)
+	}
+	if err := e.Close(); !errors.Is(err, ErrState) {
+		t.Fatalf("Close in setup: got %v, want ErrState", err)
+	}
+	if _, err := New(dir, testDraft(t)); err == nil {
+		t.Fatalf("New overwrote an existing election")
+	}
+}
+
+func TestElectionRejectsForeignBallot(t *testing.T) {
+	e, _ := openElection(t)
+	other, _ := openElection(t)
+	m, h, _ := other.Manifest()
+	pk, _ := m.Key()
+	q, _ := m.Question("chair")
+	spec, _ := q.Spec(h)
+	b, err := spec.Encrypt(pk, []uint64{1, 0, 0}, rand.Reader)
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if err := e.Cast("chair", b); err == nil {
+		t.Fatalf("ballot for another election accepted")
+	}
+	if e.Ballots("chair") != 0 {
+		t.Fatalf("rejected ballot was tallied")
+	}
+}
+
+func TestElectionRejectsReplayedBallot(t *testing.T) {
+	e, dir := openElection(t)
+	m, h, _ := e.Manifest()
+	pk, _ := m.Key()
+	q, _ := m.Question("chair")
+	spec, _ := q.Spec(h)
+	b, err := spec.Encrypt(pk, []uint64{1, 0, 0}, rand.Reader)
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if err := e.Cast("chair", b); err != nil {
+		t.Fatalf("Cast failed: %v", err)
+	}
+	if err := e.Cast("chair", b); err == nil {
+		t.Fatalf("replayed ballot accepted")
+	}
+
+	// A crash tore the next line of the ballot log; the replayed ballot
+	// is still rejected after the restart.
+	f, err := os.OpenFile(filepath.Join(dir, ballotsFile), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	f.WriteString(`{"question":"chair","entries":["AAE`)
+	f.Close()
+	e, err = Load(dir)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if e.Ballots("chair") != 1 {
+		t.Fatalf("reloaded election has %d ballots, want 1", e.Ballots("chair"))
+	}
+	if err := e.Cast("chair", b); err == nil {
+		t.Fatalf("replayed ballot accepted after restart")
+	}
+	other, err := spec.Encrypt(pk, []uint64{0, 1, 0}, rand.Reader)
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if err := e.Cast("chair", other); err != nil {
+		t.Fatalf("Cast after restart failed: %v", err)
+	}
+	e, err = Load(dir)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if e.Ballots("chair") != 2 {
+		t.Fatalf("reloaded election has %d ballots, want 2", e.Ballots("chair"))
+	}
+}
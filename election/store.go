@@ -0,0 +1,295 @@
+package election
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	"github.com/p4u/m1fp-go/m1fp"
+)
+
+// Files kept in the election directory.
+const (
+	stateFile   = "election.json" // record, rewritten after every change
+	keyFile     = "election.key"  // Secret integer of the election key, owner-only
+	ballotsFile = "ballots.jsonl" // Counters of every tallied ballot, one per line
+)
+
+// loggedBallot is a line of the ballot log: the counters one ballot added
+// to the tally of a question.
+type loggedBallot struct {
+	Question string             `json:"question"`
+	Entries  []*m1fp.Ciphertext `json:"entries"`
+}
+
+// ballotKey identifies the counters of a ballot, see keyOf.
+type ballotKey [sha256.Size]byte
+
+// keyOf returns SHA-256 of the question ID and the encoded counters, each
+// prefixed with its length (uint32 BE).
+func keyOf(questionID string, entries []*m1fp.Ciphertext) (ballotKey, error) {
+	d := sha256.New()
+	field := func(b []byte) {
+		var n [4]byte
+		binary.BigEndian.PutUint32(n[:], uint32(len(b)))
+		d.Write(n[:])
+		d.Write(b)
+	}
+	field([]byte(questionID))
+	for i, ct := range entries {
+		data, err := ct.MarshalBinary()
+		if err != nil {
+			return ballotKey{}, fmt.Errorf("question %q: counter %d: %w", questionID, i, err)
+		}
+		field(data)
+	}
+	return ballotKey(d.Sum(nil)), nil
+}
+
+// Load reopens the election persisted in dir.
+func Load(dir string) (*Election, error) {
+	data, err := os.ReadFile(filepath.Join(dir, stateFile))
+	if err != nil {
+		return nil, err
+	}
+	e := &Election{dir: dir}
+	if err := json.Unmarshal(data, &e.rec); err != nil {
+		return nil, fmt.Errorf("election state: %w", err)
+	}
+	if _, ok := next[e.rec.State]; !ok && e.rec.State != StatePublished {
+		return nil, fmt.Errorf("election state: unknown state %q", e.rec.State)
+	}
+	if e.rec.Manifest == nil {
+		return nil, fmt.Errorf("election state: missing manifest")
+	}
+	if e.rec.Manifest.PublicKey != nil {
+		if err := e.load(); err != nil {
+			return nil, err
+		}
+		if err := e.openBallots(); err != nil {
+			return nil, err
+		}
+		if e.rec.State != StateOpen {
+			if err := e.closeBallots(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return e, nil
+}
+
+// load derives the key, the manifest hash and the ballot specs from a
+// manifest that carries the public key, and starts an empty tally for
+// every question.
+func (e *Election) load() error {
+	m := e.rec.Manifest
+	h, err := m.Hash()
+	if err != nil {
+		return err
+	}
+	pk, err := m.Key()
+	if err != nil {
+		return err
+	}
+	specs := make(map[string]m1fp.BallotSpec)
+	tallies := make(map[string]*m1fp.TallyVector)
+	for i := range m.Questions {
+		q := &m.Questions[i]
+		if !q.Ranked() {
+			if specs[q.ID], err = q.Spec(h); err != nil {
+				return fmt.Errorf("question %q: %w", q.ID, err)
+			}
+		}
+		tallies[q.ID] = m1fp.NewTallyVector(q.ResultSize())
+	}
+	e.hash, e.pk, e.specs = h, pk, specs
+	e.tallies, e.seen = tallies, make(map[ballotKey]bool)
+	return nil
+}
+
+// openBallots opens the ballot log, creating it if needed, and adds every
+// ballot in it to the tallies. A torn line left by a crash at its end is a
+// ballot whose Cast never returned, and is discarded.
+func (e *Election) openBallots() error {
+	f, err := os.OpenFile(filepath.Join(e.dir, ballotsFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	var offset int64
+	in := bufio.NewReader(f)
+	for {
+		line, err := in.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err == nil {
+			err = e.replay(line)
+		}
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("ballot log at %d: %w", offset, err)
+		}
+		offset += int64(len(line))
+	}
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	e.ballots = f
+	return nil
+}
+
+// replay adds a line of the ballot log to the tallies.
+func (e *Election) replay(line []byte) error {
+	var b loggedBallot
+	if err := json.Unmarshal(line, &b); err != nil {
+		return err
+	}
+	tv, ok := e.tallies[b.Question]
+	if !ok {
+		return fmt.Errorf("unknown question %q", b.Question)
+	}
+	key, err := keyOf(b.Question, b.Entries)
+	if err != nil {
+		return err
+	}
+	if err := tv.AddEntries(b.Entries, e.pk.Prec); err != nil {
+		return fmt.Errorf("question %q: %w", b.Question, err)
+	}
+	e.seen[key] = true
+	return nil
+}
+
+// logBallot appends the counters of a ballot to the ballot log durably. If
+// the write fails the log is truncated back; if that fails too, further
+// ballots are refused, since the log may hold a ballot that is not tallied.
+func (e *Election) logBallot(questionID string, entries []*m1fp.Ciphertext) error {
+	if e.err != nil {
+		return e.err
+	}
+	line, err := json.Marshal(&loggedBallot{Question: questionID, Entries: entries})
+	if err != nil {
+		return err
+	}
+	offset, err := e.ballots.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = e.ballots.Write(append(line, '\n')); err == nil {
+		err = e.ballots.Sync()
+	}
+	if err != nil {
+		terr := e.ballots.Truncate(offset)
+		if terr == nil {
+			_, terr = e.ballots.Seek(offset, io.SeekStart)
+		}
+		if terr != nil {
+			e.err = fmt.Errorf("ballot log may hold an untallied ballot: %w", terr)
+		}
+		return err
+	}
+	return nil
+}
+
+// closeBallots closes the ballot log once no more ballots are accepted.
+func (e *Election) closeBallots() error {
+	if e.ballots == nil {
+		return nil
+	}
+	err := e.ballots.Close()
+	e.ballots = nil
+	return err
+}
+
+// create initializes the election directory with the current record.
+func (e *Election) create() error {
+	if err := os.MkdirAll(e.dir, 0o700); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(e.dir, stateFile)); err == nil {
+		return fmt.Errorf("%s already holds an election", e.dir)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return e.save()
+}
+
+// save persists the record atomically.
+func (e *Election) save() error {
+	data, err := json.MarshalIndent(&e.rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(e.dir, stateFile), data, 0o644)
+}
+
+// saveKey stores the secret integer of sk, readable by the owner only.
+func (e *Election) saveKey(sk *m1fp.PrivateKey) error {
+	text, err := sk.A.MarshalText()
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(e.dir, keyFile), text, 0o600)
+}
+
+// loadKey reads the private key stored by saveKey.
+func (e *Election) loadKey() (*m1fp.PrivateKey, error) {
+	text, err := os.ReadFile(filepath.Join(e.dir, keyFile))
+	if err != nil {
+		return nil, err
+	}
+	a := new(big.Int)
+	if err := a.UnmarshalText(text); err != nil {
+		return nil, fmt.Errorf("election key: %w", err)
+	}
+	return &m1fp.PrivateKey{A: a, PK: *e.pk}, nil
+}
+
+// writeFile replaces path with data atomically: the data is written to a
+// temporary file in the same directory, synced and renamed over path.
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,78 @@
+// Package eligibility decides who may vote. The census is a Merkle tree
+// (see package merkle) over the Ed25519 public keys of eligible voters;
+// voters sign their ballots into envelopes carrying a census proof and a
+// per-election nullifier, and a Gate admits each nullifier at most once
+// before the ballots reach the tally.
+package eligibility
+
+import (
+	"crypto/ed25519"
+	"fmt"
+
+	"github.com/p4u/m1fp-go/merkle"
+)
+
+// Census is the list of eligible voter keys.
+type Census struct {
+	tree  merkle.Tree
+	index map[string]uint64
+}
+
+// CensusProof shows that a voter key is a leaf of the census tree.
+type CensusProof struct {
+	Index uint64        `json:"index"`
+	Size  uint64        `json:"size"`
+	Path  []merkle.Hash `json:"path"`
+}
+
+// NewCensus builds the census of the given voter keys, in order.
+func NewCensus(voters []ed25519.PublicKey) (*Census, error) {
+	c := &Census{index: make(map[string]uint64, len(voters))}
+	for i, pub := range voters {
+		if len(pub) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("voter %d: invalid public key", i)
+		}
+		if _, ok := c.index[string(pub)]; ok {
+			return nil, fmt.Errorf("voter %d: duplicate public key", i)
+		}
+		c.index[string(pub)] = c.tree.Append(pub)
+	}
+	return c, nil
+}
+
+// Root returns the census root published with the election.
+func (c *Census) Root() merkle.Hash {
+	return c.tree.Root()
+}
+
+// Size returns the number of eligible voters.
+func (c *Census) Size() uint64 {
+	return c.tree.Size()
+}
+
+// Prove returns the census proof of voter pub.
+func (c *Census) Prove(pub ed25519.PublicKey) (*CensusProof, error) {
+	i, ok := c.index[string(pub)]
+	if !ok {
+		return nil, fmt.Errorf("voter not in census")
+	}
+	path, err := c.tree.InclusionProof(i, c.tree.Size())
+	if err != nil {
+		return nil, err
+	}
+	return &CensusProof{Index: i, Size: c.tree.Size(), Path: path}, nil
+}
+
+// VerifyCensus checks that pub is in the census of the given root and size.
+func VerifyCensus(root merkle.Hash, size uint64, pub ed25519.PublicKey, proof *CensusProof) error {
+	if proof == nil {
+		return fmt.Errorf("missing census proof")
+	}
+	if proof.Size != size {
+		return fmt.Errorf("census proof for %d voters, census has %d", proof.Size, size)
+	}
+	if err := merkle.VerifyInclusion(merkle.LeafHash(pub), proof.Index, proof.Size, proof.Path, root); err != nil {
+		return fmt.Errorf("voter not in census: %w", err)
+	}
+	return nil
+}
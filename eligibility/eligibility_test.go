@@ -0,0 +1,160 @@
+package eligibility
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/p4u/m1fp-go/m1fp"
+	"github.com/p4u/m1fp-go/manifest"
+)
+
+func testElection(t *testing.T) (*m1fp.PrivateKey, *manifest.Manifest, manifest.Hash) {
+	t.Helper()
+	sk, pk, err := m1fp.KeyGen(256, m1fp.X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+	pkBytes, _ := pk.MarshalBinary()
+	trustee, _, _ := ed25519.GenerateKey(rand.Reader)
+	m := &manifest.Manifest{
+		Version:    manifest.Version,
+		ElectionID: "assembly",
+		Parameters: manifest.DefaultParameters(),
+		PublicKey:  pkBytes,
+		Trustees:   []manifest.Trustee{{ID: "t", PublicKey: trustee}},
+		Questions: []manifest.Question{
+			{ID: "motion", Options: []string{"yes", "no"}, Mode: m1fp.ModePlurality},
+			{ID: "order", Options: []string{"a", "b", "c"}, Mode: manifest.ModeBorda},
+		},
+	}
+	h, err := m.Hash()
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+	return sk, m, h
+}
+
+func answers(t *testing.T, m *manifest.Manifest, h manifest.Hash, voter ed25519.PrivateKey, choice int, ranking []int) []Answer {
+	t.Helper()
+	pk, _ := m.Key()
+	n := NullifierOf(h, voter.Public().(ed25519.PublicKey))
+	motion, _ := m.Question("motion")
+	spec, _ := Spec(h, motion, n)
+	values := make([]uint64, 2)
+	values[choice] = 1
+	b, err := spec.Encrypt(pk, values, rand.Reader)
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	order, _ := m.Question("order")
+	rb, err := m1fp.EncryptBorda(pk, ranking, Context(h, order, n), rand.Reader)
+	if err != nil {
+		t.Fatalf("EncryptBorda failed: %v", err)
+	}
+	return []Answer{{QuestionID: "motion", Ballot: b}, {QuestionID: "order", Borda: rb}}
+}
+
+func TestGateAdmitsEligibleVotersOnce(t *testing.T) {
+	sk, m, h := testElection(t)
+
+	keys := make([]ed25519.PrivateKey, 3)
+	pubs := make([]ed25519.PublicKey, 3)
+	for i := range keys {
+		pubs[i], keys[i], _ = ed25519.GenerateKey(rand.Reader)
+	}
+	census, err := NewCensus(pubs)
+	if err != nil {
+		t.Fatalf("NewCensus failed: %v", err)
+	}
+	gate, err := NewGate(m, census.Root(), census.Size())
+	if err != nil {
+		t.Fatalf("NewGate failed: %v", err)
+	}
+
+	seal := func(key ed25519.PrivateKey, choice int, ranking []int) *Envelope {
+		t.Helper()
+		proof, err := census.Prove(key.Public().(ed25519.PublicKey))
+		if err != nil {
+			t.Fatalf("Prove failed: %v", err)
+		}
+		e, err := Seal(key, h, answers(t, m, h, key, choice, ranking), proof)
+		if err != nil {
+			t.Fatalf("Seal failed: %v", err)
+		}
+		// Envelopes travel as JSON.
+		data, err := json.Marshal(e)
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		out := new(Envelope)
+		if err := json.Unmarshal(data, out); err != nil {
+			t.Fatalf("Unmarshal failed: %v", err)
+		}
+		return out
+	}
+
+	first := seal(keys[0], 0, []int{0, 1, 2})
+	if _, err := gate.Admit(first); err != nil {
+		t.Fatalf("eligible voter rejected: %v", err)
+	}
+	if _, err := gate.Admit(seal(keys[1], 1, []int{2, 0, 1})); err != nil {
+		t.Fatalf("eligible voter rejected: %v", err)
+	}
+	if _, err := gate.Admit(seal(keys[0], 1, []int{2, 1, 0})); err == nil {
+		t.Fatalf("double vote admitted")
+	}
+
+	_, outsider, _ := ed25519.GenerateKey(rand.Reader)
+	stolen, _ := census.Prove(pubs[2])
+	e, err := Seal(outsider, h, answers(t, m, h, outsider, 0, []int{0, 1, 2}), stolen)
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	if _, err := gate.Admit(e); err == nil {
+		t.Fatalf("voter outside the census admitted")
+	}
+
+	forged := seal(keys[2], 0, []int{0, 1, 2})
+	forged.Answers[0] = answers(t, m, h, keys[2], 1, []int{0, 1, 2})[0]
+	if _, err := gate.Admit(forged); err == nil {
+		t.Fatalf("envelope with altered answers admitted")
+	}
+
+	// An eligible voter cannot copy the answers of another voter into an
+	// envelope of their own: the proofs are bound to the first voter.
+	proof, _ := census.Prove(pubs[2])
+	copied, err := Seal(keys[2], h, first.Answers, proof)
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	if _, err := gate.Admit(copied); err == nil {
+		t.Fatalf("envelope with copied answers admitted")
+	}
+
+	motion, err := gate.Tally("motion")
+	if err != nil {
+		t.Fatalf("Tally failed: %v", err)
+	}
+	counts, err := motion.Decrypt(sk)
+	if err != nil {
+		t.Fatalf("Decrypt failed: %v", err)
+	}
+	if !slices.Equal(counts, []uint64{1, 1}) || motion.Ballots != 2 {
+		t.Fatalf("motion tally %v over %d ballots, want [1 1] over 2", counts, motion.Ballots)
+	}
+	order, _ := gate.Tally("order")
+	scores, _ := order.Decrypt(sk)
+	if !slices.Equal(scores, []uint64{3, 1, 2}) {
+		t.Fatalf("order scores %v, want [3 1 2]", scores)
+	}
+}
+
+func TestNullifierIsPerElection(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	if NullifierOf(manifest.Hash{1}, pub) == NullifierOf(manifest.Hash{2}, pub) {
+		t.Fatalf("nullifier does not depend on the election")
+	}
+}
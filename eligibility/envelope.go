@@ -0,0 +1,306 @@
+package eligibility
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/p4u/m1fp-go/canonical"
+	"github.com/p4u/m1fp-go/m1fp"
+	"github.com/p4u/m1fp-go/manifest"
+	"github.com/p4u/m1fp-go/merkle"
+)
+
+// Domain separators of the hashes and signatures of this package.
+const (
+	nullifierDomain = "m1fp/eligibility/nullifier"
+	envelopeDomain  = "m1fp/eligibility/envelope"
+)
+
+// Nullifier identifies a voter within one election. It is the same for
+// every envelope the voter signs in that election, and unrelated across
+// elections. It does not hide the voter key, which the envelope carries.
+type Nullifier [sha256.Size]byte
+
+// MarshalText encodes the nullifier in hexadecimal.
+func (n Nullifier) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(n[:])), nil
+}
+
+// UnmarshalText decodes a hexadecimal nullifier.
+func (n *Nullifier) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(string(text))
+	if err != nil {
+		return fmt.Errorf("nullifier: %w", err)
+	}
+	if len(b) != len(n) {
+		return fmt.Errorf("nullifier must be %d bytes", len(n))
+	}
+	copy(n[:], b)
+	return nil
+}
+
+// NullifierOf returns SHA-256(domain || manifest hash || voter key).
+func NullifierOf(h manifest.Hash, voter ed25519.PublicKey) Nullifier {
+	buf := make([]byte, 0, len(nullifierDomain)+len(h)+len(voter))
+	buf = append(buf, nullifierDomain...)
+	buf = append(buf, h[:]...)
+	buf = append(buf, voter...)
+	return sha256.Sum256(buf)
+}
+
+// Context returns the context that the ballot proofs of an answer to q must
+// be bound to by the voter with nullifier n in the election h: the question
+// context of the manifest followed by the nullifier. Binding the proofs to
+// the voter keeps an eligible voter from copying the answers of another
+// voter into their own envelope.
+func Context(h manifest.Hash, q *manifest.Question, n Nullifier) []byte {
+	return append(q.Context(h), n[:]...)
+}
+
+// Spec returns the ballot spec of a non-ranked question q with its proofs
+// bound to the voter with nullifier n, see Context.
+func Spec(h manifest.Hash, q *manifest.Question, n Nullifier) (m1fp.BallotSpec, error) {
+	s, err := q.Spec(h)
+	if err != nil {
+		return m1fp.BallotSpec{}, err
+	}
+	s.Context = Context(h, q, n)
+	return s, nil
+}
+
+// Answer is the encrypted answer to one question. Exactly one ballot field
+// is set, matching the mode of the question, with its proofs bound to the
+// voter by Context.
+type Answer struct {
+	QuestionID string                `json:"question_id"`
+	Ballot     *m1fp.Ballot          `json:"ballot,omitempty"`
+	Borda      *m1fp.BordaBallot     `json:"borda,omitempty"`
+	Condorcet  *m1fp.CondorcetBallot `json:"condorcet,omitempty"`
+}
+
+// Envelope is a ballot signed by an eligible voter: one answer per question
+// of the manifest, in manifest order, with their validity proofs.
+type Envelope struct {
+	Manifest  manifest.Hash     `json:"manifest"`
+	Answers   []Answer          `json:"answers"`
+	Voter     ed25519.PublicKey `json:"voter"`
+	Census    *CensusProof      `json:"census"`
+	Nullifier Nullifier         `json:"nullifier"`
+	Signature []byte            `json:"signature"`
+}
+
+// Seal signs answers for the election h with the voter key.
+func Seal(key ed25519.PrivateKey, h manifest.Hash, answers []Answer, census *CensusProof) (*Envelope, error) {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid voter key")
+	}
+	pub := key.Public().(ed25519.PublicKey)
+	e := &Envelope{
+		Manifest:  h,
+		Answers:   answers,
+		Voter:     pub,
+		Census:    census,
+		Nullifier: NullifierOf(h, pub),
+	}
+	msg, err := e.message()
+	if err != nil {
+		return nil, err
+	}
+	e.Signature = ed25519.Sign(key, msg)
+	return e, nil
+}
+
+// message returns the bytes covered by the voter signature: the domain
+// followed by SHA-256 of the manifest hash, the nullifier and the canonical
+// JSON encoding of the answers, each prefixed with its length (uint32 BE).
+// The canonical encoding lets any implementation recompute the message from
+// the envelope it received.
+func (e *Envelope) message() ([]byte, error) {
+	answers, err := canonical.Marshal(e.Answers)
+	if err != nil {
+		return nil, err
+	}
+	d := sha256.New()
+	for _, field := range [][]byte{e.Manifest[:], e.Nullifier[:], answers} {
+		var n [4]byte
+		binary.BigEndian.PutUint32(n[:], uint32(len(field)))
+		d.Write(n[:])
+		d.Write(field)
+	}
+	return d.Sum([]byte(envelopeDomain)), nil
+}
+
+// Gate admits envelopes for one election: it checks the signature, the
+// census proof, the nullifier and every ballot proof, and only then adds
+// the ballots to per-question tallies. Each nullifier is admitted once, so
+// double votes are rejected before any ciphertext is added. Admitted
+// nullifiers are only kept in memory: a restarted gate must admit the
+// recorded envelopes again, as record.Open does. A Gate is safe for
+// concurrent use.
+type Gate struct {
+	mu         sync.Mutex
+	m          *manifest.Manifest
+	hash       manifest.Hash
+	pk         *m1fp.PublicKey
+	censusRoot merkle.Hash
+	censusSize uint64
+	seen       map[Nullifier]bool
+	tallies    map[string]*m1fp.TallyVector
+}
+
+// NewGate returns a gate for the election m with the given census.
+func NewGate(m *manifest.Manifest, censusRoot merkle.Hash, censusSize uint64) (*Gate, error) {
+	h, err := m.Hash()
+	if err != nil {
+		return nil, err
+	}
+	pk, err := m.Key()
+	if err != nil {
+		return nil, err
+	}
+	g := &Gate{
+		m:          m,
+		hash:       h,
+		pk:         pk,
+		censusRoot: censusRoot,
+		censusSize: censusSize,
+		seen:       make(map[Nullifier]bool),
+		tallies:    make(map[string]*m1fp.TallyVector),
+	}
+	for _, q := range m.Questions {
+		g.tallies[q.ID] = m1fp.NewTallyVector(q.ResultSize())
+	}
+	return g, nil
+}
+
+// Admit verifies e, adds its answers to the tallies and returns the
+// counters it added, one slice per question in manifest order.
+func (g *Gate) Admit(e *Envelope) ([][]*m1fp.Ciphertext, error) {
+	return g.AdmitFunc(e, nil)
+}
+
+// AdmitFunc is Admit calling record, if not nil, with the counters of e
+// once e has been verified and before it is admitted. If record fails, e is
+// not admitted and its voter can still vote, so record can persist the
+// envelope and roll back its own writes on failure. Calls to record are
+// serialized.
+func (g *Gate) AdmitFunc(e *Envelope, record func(counters [][]*m1fp.Ciphertext) error) ([][]*m1fp.Ciphertext, error) {
+	counters, err := g.Verify(e)
+	if err != nil {
+		return nil, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.seen[e.Nullifier] {
+		return nil, fmt.Errorf("voter has already voted")
+	}
+	next := make([]*m1fp.TallyVector, len(counters))
+	for i, q := range g.m.Questions {
+		cur := g.tallies[q.ID]
+		next[i] = &m1fp.TallyVector{Entries: cur.Entries, Ballots: cur.Ballots}
+		if err := next[i].AddEntries(counters[i], g.pk.Prec); err != nil {
+			return nil, fmt.Errorf("question %q: %w", q.ID, err)
+		}
+	}
+	if record != nil {
+		if err := record(counters); err != nil {
+			return nil, err
+		}
+	}
+	for i, q := range g.m.Questions {
+		g.tallies[q.ID] = next[i]
+	}
+	g.seen[e.Nullifier] = true
+	return counters, nil
+}
+
+// Verify checks the signature, census proof, nullifier and ballot proofs of
+// e without admitting it, and returns the counters each answer adds to the
+// tally of its question. It does not check for double votes.
+func (g *Gate) Verify(e *Envelope) ([][]*m1fp.Ciphertext, error) {
+	if e == nil {
+		return nil, fmt.Errorf("nil envelope")
+	}
+	if e.Manifest != g.hash {
+		return nil, fmt.Errorf("envelope belongs to another election")
+	}
+	if len(e.Voter) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid voter key")
+	}
+	msg, err := e.message()
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(e.Voter, msg, e.Signature) {
+		return nil, fmt.Errorf("invalid voter signature")
+	}
+	if err := VerifyCensus(g.censusRoot, g.censusSize, e.Voter, e.Census); err != nil {
+		return nil, err
+	}
+	if e.Nullifier != NullifierOf(g.hash, e.Voter) {
+		return nil, fmt.Errorf("nullifier does not match the voter")
+	}
+	if len(e.Answers) != len(g.m.Questions) {
+		return nil, fmt.Errorf("envelope must answer %d questions", len(g.m.Questions))
+	}
+	counters := make([][]*m1fp.Ciphertext, len(e.Answers))
+	for i := range e.Answers {
+		if counters[i], err = g.verifyAnswer(&g.m.Questions[i], &e.Answers[i], e.Nullifier); err != nil {
+			return nil, fmt.Errorf("question %q: %w", g.m.Questions[i].ID, err)
+		}
+	}
+	return counters, nil
+}
+
+// Tally returns the encrypted tally of a question over the admitted envelopes.
+func (g *Gate) Tally(questionID string) (*m1fp.TallyVector, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	tv, ok := g.tallies[questionID]
+	if !ok {
+		return nil, fmt.Errorf("unknown question %q", questionID)
+	}
+	return &m1fp.TallyVector{Entries: tv.Entries, Ballots: tv.Ballots}, nil
+}
+
+// verifyAnswer checks the ballot proofs of one answer by the voter with
+// nullifier n and returns the counters it adds to the tally of its question.
+func (g *Gate) verifyAnswer(q *manifest.Question, a *Answer, n Nullifier) ([]*m1fp.Ciphertext, error) {
+	if a.QuestionID != q.ID {
+		return nil, fmt.Errorf("answer is for question %q", a.QuestionID)
+	}
+	k := len(q.Options)
+	context := Context(g.hash, q, n)
+	switch {
+	case q.Mode == manifest.ModeBorda && a.Borda != nil && a.Ballot == nil && a.Condorcet == nil:
+		if err := m1fp.VerifyBorda(g.pk, k, context, a.Borda); err != nil {
+			return nil, err
+		}
+		return a.Borda.Scores()
+	case q.Mode == manifest.ModeCondorcet && a.Condorcet != nil && a.Ballot == nil && a.Borda == nil:
+		if err := m1fp.VerifyCondorcet(g.pk, k, context, a.Condorcet); err != nil {
+			return nil, err
+		}
+		var cells []*m1fp.Ciphertext
+		for _, row := range a.Condorcet.Preferences {
+			cells = append(cells, row...)
+		}
+		return cells, nil
+	case !q.Ranked() && a.Ballot != nil && a.Borda == nil && a.Condorcet == nil:
+		spec, err := Spec(g.hash, q, n)
+		if err != nil {
+			return nil, err
+		}
+		if err := spec.Verify(g.pk, a.Ballot); err != nil {
+			return nil, err
+		}
+		return a.Ballot.Entries, nil
+	default:
+		return nil, fmt.Errorf("answer does not match the %s mode", q.Mode)
+	}
+}
@@ -0,0 +1,54 @@
+package m1fp
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// AuditBallot is a ballot opened by the voter under the Benaloh
+// cast-or-audit challenge. It reveals the vote and the randomness, so the
+// underlying ciphertext is spoiled and must never be cast. Ciphertexts carry
+// no spoiled state of their own: the bulletin board records spoiled ballots
+// and refuses to post them (see board.Board.Spoil).
+type AuditBallot struct {
+	Ciphertext *Ciphertext // Spoiled ciphertext produced by the voting device
+	Vote       uint64      // Vote the device claims to have encrypted
+	R          *big.Int    // Randomness the device claims to have used
+}
+
+// VerifyOpening recomputes the encryption of vote with randomness r under pk
+// and checks that it matches ct exactly.
+func VerifyOpening(pk *PublicKey, ct *Ciphertext, vote uint64, r *big.Int) error {
+	if err := checkVoteCiphertext(pk, ct); err != nil {
+		return err
+	}
+	if r == nil {
+		return fmt.Errorf("missing encryption randomness")
+	}
+	if vote >= VoteMod {
+		return fmt.Errorf("vote out of range")
+	}
+	want := encryptInt(pk, new(big.Int).SetUint64(vote), r)
+	if want.c1.Cmp(ct.c1) != 0 || want.c2.Cmp(ct.c2) != 0 {
+		return fmt.Errorf("ciphertext does not open to vote %d", vote)
+	}
+	return nil
+}
+
+// Audit opens ct for auditing under pk. It fails unless ct encrypts vote
+// with randomness r, and leaves ct unchanged; the returned ballot is what
+// gets published and recorded as spoiled.
+func Audit(pk *PublicKey, ct *Ciphertext, vote uint64, r *big.Int) (*AuditBallot, error) {
+	if err := VerifyOpening(pk, ct, vote, r); err != nil {
+		return nil, err
+	}
+	return &AuditBallot{Ciphertext: ct, Vote: vote, R: new(big.Int).Set(r)}, nil
+}
+
+// Verify checks that the audited ballot opens to the claimed vote under pk.
+func (a *AuditBallot) Verify(pk *PublicKey) error {
+	if a == nil {
+		return fmt.Errorf("nil audit ballot")
+	}
+	return VerifyOpening(pk, a.Ciphertext, a.Vote, a.R)
+}
@@ -0,0 +1,45 @@
+package m1fp
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestCastOrAudit(t *testing.T) {
+	_, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	ct, r, err := EncryptVote(pk, 12, nil)
+	if err != nil {
+		t.Fatalf("EncryptVote failed: %v", err)
+	}
+	if err := VerifyOpening(pk, ct, 12, r); err != nil {
+		t.Fatalf("honest opening rejected: %v", err)
+	}
+	if err := VerifyOpening(pk, ct, 13, r); err == nil {
+		t.Fatalf("opening to a different vote accepted")
+	}
+	if err := VerifyOpening(pk, ct, 12, new(big.Int).Add(r, big.NewInt(1))); err == nil {
+		t.Fatalf("opening with different randomness accepted")
+	}
+
+	// A device lying about the ballot cannot produce an audit ballot.
+	if _, err := Audit(pk, ct, 13, r); err == nil {
+		t.Fatalf("audit of a false opening succeeded")
+	}
+
+	// The voter challenges the ballot: it is opened and published.
+	audit, err := Audit(pk, ct, 12, r)
+	if err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+	if err := audit.Verify(pk); err != nil {
+		t.Fatalf("audit ballot did not verify: %v", err)
+	}
+	audit.Vote = 13
+	if err := audit.Verify(pk); err == nil {
+		t.Fatalf("altered audit ballot verified")
+	}
+}
@@ -0,0 +1,279 @@
+package m1fp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// BallotMode selects how the entries of a multi-candidate ballot are
+// constrained.
+type BallotMode string
+
+const (
+	// ModePlurality ballots select exactly one option: every entry is 0 or 1
+	// and the entries add up to 1.
+	ModePlurality BallotMode = "plurality"
+	// ModeApproval ballots approve any subset of options: every entry is 0 or 1.
+	ModeApproval BallotMode = "approval"
+	// ModeScore ballots give every option a score between 0 and MaxScore.
+	ModeScore BallotMode = "score"
+	// ModeCumulative ballots spread Budget points over the options, spending
+	// at most the budget, or exactly the budget when ExactBudget is set.
+	ModeCumulative BallotMode = "cumulative"
+)
+
+// BallotSpec describes the ballots accepted for one question. It is meant
+// to be loaded from the election configuration, e.g. as JSON:
+//
+//	{"mode": "score", "options": 5, "max_score": 10}
+type BallotSpec struct {
+	Mode        BallotMode `json:"mode"`
+	Options     int        `json:"options"`
+	MaxScore    uint64     `json:"max_score,omitempty"`    // Score mode: highest score per option
+	Budget      uint64     `json:"budget,omitempty"`       // Cumulative mode: points per voter
+	ExactBudget bool       `json:"exact_budget,omitempty"` // Cumulative mode: all points must be spent
+
+	// Context binds the proofs of every ballot to an election, typically
+	// the manifest hash, so a ballot cannot be replayed under another one.
+	Context []byte `json:"-"`
+}
+
+// PluralitySpec returns the spec of a single-choice ballot over options candidates.
+func PluralitySpec(options int) BallotSpec {
+	return BallotSpec{Mode: ModePlurality, Options: options}
+}
+
+// Validate checks that the spec is complete and consistent with its mode.
+func (s BallotSpec) Validate() error {
+	if s.Options < 1 {
+		return fmt.Errorf("ballot needs at least one option")
+	}
+	switch s.Mode {
+	case ModePlurality, ModeApproval:
+	case ModeScore:
+		if s.MaxScore < 1 {
+			return fmt.Errorf("score ballots need a positive max_score")
+		}
+	case ModeCumulative:
+		if s.Budget < 1 {
+			return fmt.Errorf("cumulative ballots need a positive budget")
+		}
+	default:
+		return fmt.Errorf("unknown ballot mode %q", s.Mode)
+	}
+	if err := s.entryRange().validate(); err != nil {
+		return err
+	}
+	if sr, ok := s.sumRange(); ok {
+		return sr.validate()
+	}
+	return nil
+}
+
+// entryRange returns the range every single entry must lie in.
+func (s BallotSpec) entryRange() VoteRange {
+	switch s.Mode {
+	case ModeScore:
+		return VoteRange{Min: 0, Max: s.MaxScore}
+	case ModeCumulative:
+		return VoteRange{Min: 0, Max: s.Budget}
+	default:
+		return VoteRange{Min: 0, Max: 1}
+	}
+}
+
+// sumRange returns the range of the sum of all entries, if the mode constrains it.
+func (s BallotSpec) sumRange() (VoteRange, bool) {
+	switch s.Mode {
+	case ModePlurality:
+		return VoteRange{Min: 1, Max: 1}, true
+	case ModeCumulative:
+		if s.ExactBudget {
+			return VoteRange{Min: s.Budget, Max: s.Budget}, true
+		}
+		return VoteRange{Min: 0, Max: s.Budget}, true
+	default:
+		return VoteRange{}, false
+	}
+}
+
+// Ballot is a multi-candidate ballot holding one vote ciphertext per option.
+// EntryProofs show that every entry is in range, and SumProof constrains the
+// homomorphic sum of all entries when the ballot mode requires it.
+type Ballot struct {
+	Context     []byte // Election context the proofs are bound to
+	Entries     []*Ciphertext
+	EntryProofs []*RangeProof
+	SumProof    *RangeProof
+}
+
+// Encrypt encrypts values, one per option, as a ballot of this spec together
+// with its validity proofs. Randomness is read from random.
+func (s BallotSpec) Encrypt(pk *PublicKey, values []uint64, random io.Reader) (*Ballot, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	if len(values) != s.Options {
+		return nil, fmt.Errorf("ballot must have %d entries", s.Options)
+	}
+
+	er := s.entryRange()
+	b := &Ballot{
+		Context:     bytes.Clone(s.Context),
+		Entries:     make([]*Ciphertext, s.Options),
+		EntryProofs: make([]*RangeProof, s.Options),
+	}
+	var total uint64
+	rSum := new(big.Int)
+	for i, v := range values {
+		if !er.Contains(v) {
+			return nil, fmt.Errorf("entry %d: value %d outside range [%d, %d]", i, v, er.Min, er.Max)
+		}
+		ct, r, err := encryptVoteRandom(pk, v, random)
+		if err != nil {
+			return nil, err
+		}
+		if b.EntryProofs[i], err = proveRange(pk, ct, v, r, RandomnessBits, er, s.Context, random); err != nil {
+			return nil, err
+		}
+		b.Entries[i] = ct
+		total += v
+		rSum.Add(rSum, r)
+	}
+
+	sr, ok := s.sumRange()
+	if !ok {
+		return b, nil
+	}
+	if !sr.Contains(total) {
+		return nil, fmt.Errorf("entries add up to %d, outside range [%d, %d]", total, sr.Min, sr.Max)
+	}
+	sum, err := AddMany(pk.Prec, b.Entries...)
+	if err != nil {
+		return nil, err
+	}
+	if b.SumProof, err = proveRange(pk, sum, total, rSum, sumBits(s.Options), sr, s.Context, random); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Verify checks that b is a valid ballot of this spec: every entry lies in
+// the entry range of the mode and, where the mode requires it, the entries
+// add up to a value in the sum range.
+func (s BallotSpec) Verify(pk *PublicKey, b *Ballot) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	if b == nil || len(b.Entries) != s.Options || len(b.EntryProofs) != s.Options {
+		return fmt.Errorf("ballot must have %d entries", s.Options)
+	}
+	if !bytes.Equal(b.Context, s.Context) {
+		return fmt.Errorf("ballot belongs to another election context")
+	}
+	er := s.entryRange()
+	for i, ct := range b.Entries {
+		if err := verifyRange(pk, ct, RandomnessBits, er, s.Context, b.EntryProofs[i]); err != nil {
+			return fmt.Errorf("entry %d: %w", i, err)
+		}
+	}
+
+	sr, ok := s.sumRange()
+	if !ok {
+		if b.SumProof != nil {
+			return fmt.Errorf("unexpected sum proof for %s ballot", s.Mode)
+		}
+		return nil
+	}
+	sum, err := AddMany(pk.Prec, b.Entries...)
+	if err != nil {
+		return err
+	}
+	if err := verifyRange(pk, sum, sumBits(s.Options), sr, s.Context, b.SumProof); err != nil {
+		return fmt.Errorf("entry sum: %w", err)
+	}
+	return nil
+}
+
+// EncryptBallot encrypts a single-choice ballot selecting choice among
+// options candidates, with proofs that each entry is 0 or 1 and that the
+// entries add up to exactly 1. Randomness is read from random.
+func EncryptBallot(pk *PublicKey, options, choice int, random io.Reader) (*Ballot, error) {
+	if choice < 0 || choice >= options {
+		return nil, fmt.Errorf("choice %d out of range [0, %d)", choice, options)
+	}
+	values := make([]uint64, options)
+	values[choice] = 1
+	return PluralitySpec(options).Encrypt(pk, values, random)
+}
+
+// VerifyBallot checks that b is a valid single-choice ballot over options
+// candidates: every entry encrypts 0 or 1 and exactly one entry is set.
+func VerifyBallot(pk *PublicKey, b *Ballot, options int) error {
+	return PluralitySpec(options).Verify(pk, b)
+}
+
+// TallyVector accumulates ballots element-wise, keeping one running
+// ciphertext per option.
+type TallyVector struct {
+	Entries []*Ciphertext
+	Ballots int // Number of ballots added so far
+}
+
+// NewTallyVector creates an empty tally for ballots with the given number of options.
+func NewTallyVector(options int) *TallyVector {
+	return &TallyVector{Entries: make([]*Ciphertext, options)}
+}
+
+// Add folds the entries of b into the tally using Ciphertext.Add.
+// The ballot should have been checked with VerifyBallot beforehand.
+func (tv *TallyVector) Add(b *Ballot, prec uint16) error {
+	if b == nil {
+		return fmt.Errorf("nil ballot")
+	}
+	return tv.AddEntries(b.Entries, prec)
+}
+
+// AddEntries folds one ciphertext per option into the tally, for ballots
+// whose counters are derived homomorphically, such as Borda scores.
+func (tv *TallyVector) AddEntries(entries []*Ciphertext, prec uint16) error {
+	if len(entries) != len(tv.Entries) {
+		return fmt.Errorf("ballot must have %d entries", len(tv.Entries))
+	}
+	next := make([]*Ciphertext, len(tv.Entries))
+	for i, ct := range entries {
+		if tv.Entries[i] == nil {
+			if ct == nil || ct.c1 == nil {
+				return fmt.Errorf("entry %d: nil ciphertext", i)
+			}
+			next[i] = ct
+			continue
+		}
+		sum, err := tv.Entries[i].Add(ct, prec)
+		if err != nil {
+			return fmt.Errorf("entry %d: %w", i, err)
+		}
+		next[i] = sum
+	}
+	tv.Entries = next
+	tv.Ballots++
+	return nil
+}
+
+// Decrypt returns the per-option counts of the tally using DecryptVote.
+func (tv *TallyVector) Decrypt(sk *PrivateKey) ([]uint64, error) {
+	counts := make([]uint64, len(tv.Entries))
+	for i, ct := range tv.Entries {
+		if ct == nil {
+			continue
+		}
+		v, err := DecryptVote(sk, ct)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+		counts[i] = v
+	}
+	return counts, nil
+}
@@ -0,0 +1,343 @@
+package m1fp
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"math/big"
+	"slices"
+	"testing"
+)
+
+func TestBallotOneHotTally(t *testing.T) {
+	sk, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	const options = 4
+	choices := []int{0, 2, 2, 3, 2, 1, 0, 2}
+	want := make([]uint64, options)
+
+	tally := NewTallyVector(options)
+	for _, choice := range choices {
+		b, err := EncryptBallot(pk, options, choice, rand.Reader)
+		if err != nil {
+			t.Fatalf("EncryptBallot failed: %v", err)
+		}
+		if err := VerifyBallot(pk, b, options); err != nil {
+			t.Fatalf("valid ballot rejected: %v", err)
+		}
+		if err := tally.Add(b, pk.Prec); err != nil {
+			t.Fatalf("TallyVector.Add failed: %v", err)
+		}
+		want[choice]++
+	}
+
+	got, err := tally.Decrypt(sk)
+	if err != nil {
+		t.Fatalf("Decrypt failed: %v", err)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("option %d: got %d, want %d", i, got[i], want[i])
+		}
+	}
+	if tally.Ballots != len(choices) {
+		t.Fatalf("ballot count: got %d, want %d", tally.Ballots, len(choices))
+	}
+}
+
+func TestBallotRejectsDoubleVote(t *testing.T) {
+	_, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	b, err := EncryptBallot(pk, 3, 1, rand.Reader)
+	if err != nil {
+		t.Fatalf("EncryptBallot failed: %v", err)
+	}
+	if err := VerifyBallot(pk, b, 4); err == nil {
+		t.Fatalf("ballot accepted with the wrong number of options")
+	}
+
+	// Swap entry 0 for a valid encryption of 1: every entry proof holds,
+	// but the entries now add up to 2.
+	r := big.NewInt(31337)
+	ct, _, err := EncryptVote(pk, 1, r)
+	if err != nil {
+		t.Fatalf("EncryptVote failed: %v", err)
+	}
+	proof, err := ProveRange(pk, ct, 1, r, VoteRange{Min: 0, Max: 1}, rand.Reader)
+	if err != nil {
+		t.Fatalf("ProveRange failed: %v", err)
+	}
+	b.Entries[0], b.EntryProofs[0] = ct, proof
+	if err := VerifyBallot(pk, b, 3); err == nil {
+		t.Fatalf("ballot voting for two options accepted")
+	}
+}
+
+func TestBallotModes(t *testing.T) {
+	sk, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	tests := []struct {
+		config  string
+		valid   [][]uint64
+		invalid [][]uint64
+	}{
+		{
+			config:  `{"mode": "approval", "options": 4}`,
+			valid:   [][]uint64{{1, 0, 1, 1}, {0, 0, 0, 0}},
+			invalid: [][]uint64{{2, 0, 0, 0}},
+		},
+		{
+			config:  `{"mode": "score", "options": 3, "max_score": 10}`,
+			valid:   [][]uint64{{10, 0, 7}, {3, 3, 3}},
+			invalid: [][]uint64{{11, 0, 0}},
+		},
+		{
+			config:  `{"mode": "cumulative", "options": 3, "budget": 5}`,
+			valid:   [][]uint64{{5, 0, 0}, {1, 2, 1}},
+			invalid: [][]uint64{{3, 3, 0}},
+		},
+		{
+			config:  `{"mode": "cumulative", "options": 3, "budget": 5, "exact_budget": true}`,
+			valid:   [][]uint64{{2, 2, 1}, {0, 5, 0}},
+			invalid: [][]uint64{{1, 2, 1}},
+		},
+	}
+
+	for _, tc := range tests {
+		var spec BallotSpec
+		if err := json.Unmarshal([]byte(tc.config), &spec); err != nil {
+			t.Fatalf("%s: bad config: %v", tc.config, err)
+		}
+
+		tally := NewTallyVector(spec.Options)
+		want := make([]uint64, spec.Options)
+		for _, values := range tc.valid {
+			b, err := spec.Encrypt(pk, values, rand.Reader)
+			if err != nil {
+				t.Fatalf("%s: Encrypt(%v) failed: %v", tc.config, values, err)
+			}
+			if err := spec.Verify(pk, b); err != nil {
+				t.Fatalf("%s: valid ballot %v rejected: %v", tc.config, values, err)
+			}
+			if err := tally.Add(b, pk.Prec); err != nil {
+				t.Fatalf("%s: TallyVector.Add failed: %v", tc.config, err)
+			}
+			for i, v := range values {
+				want[i] += v
+			}
+		}
+		got, err := tally.Decrypt(sk)
+		if err != nil {
+			t.Fatalf("%s: Decrypt failed: %v", tc.config, err)
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("%s: tally got %v, want %v", tc.config, got, want)
+		}
+
+		for _, values := range tc.invalid {
+			if _, err := spec.Encrypt(pk, values, rand.Reader); err == nil {
+				t.Fatalf("%s: invalid ballot %v encrypted", tc.config, values)
+			}
+		}
+	}
+}
+
+func TestCumulativeBudgetEnforced(t *testing.T) {
+	_, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	// A ballot made for a larger budget must not pass a smaller one.
+	loose := BallotSpec{Mode: ModeCumulative, Options: 2, Budget: 8}
+	strict := BallotSpec{Mode: ModeCumulative, Options: 2, Budget: 5}
+	b, err := loose.Encrypt(pk, []uint64{4, 4}, rand.Reader)
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if err := strict.Verify(pk, b); err == nil {
+		t.Fatalf("ballot spending 8 points accepted under a budget of 5")
+	}
+	if err := (BallotSpec{Mode: "ranked", Options: 2}).Validate(); err == nil {
+		t.Fatalf("unknown ballot mode accepted")
+	}
+}
+
+func TestBordaTally(t *testing.T) {
+	sk, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	const k = 4
+	rankings := [][]int{
+		{0, 1, 2, 3},
+		{2, 0, 3, 1},
+		{2, 1, 0, 3},
+	}
+	want := make([]uint64, k)
+	tally := NewTallyVector(k)
+	for _, ranking := range rankings {
+		b, err := EncryptBorda(pk, ranking, nil, rand.Reader)
+		if err != nil {
+			t.Fatalf("EncryptBorda failed: %v", err)
+		}
+		if err := VerifyBorda(pk, k, nil, b); err != nil {
+			t.Fatalf("valid Borda ballot rejected: %v", err)
+		}
+		scores, err := b.Scores()
+		if err != nil {
+			t.Fatalf("Scores failed: %v", err)
+		}
+		if err := tally.AddEntries(scores, pk.Prec); err != nil {
+			t.Fatalf("AddEntries failed: %v", err)
+		}
+		for pos, c := range ranking {
+			want[c] += uint64(k - 1 - pos)
+		}
+	}
+
+	got, err := tally.Decrypt(sk)
+	if err != nil {
+		t.Fatalf("Decrypt failed: %v", err)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("Borda totals: got %v, want %v", got, want)
+	}
+
+	if _, err := EncryptBorda(pk, []int{0, 0, 1, 2}, nil, rand.Reader); err == nil {
+		t.Fatalf("ranking with a repeated candidate accepted")
+	}
+}
+
+func TestBordaRejectsDuplicateScores(t *testing.T) {
+	_, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	b, err := EncryptBorda(pk, []int{0, 1, 2}, nil, rand.Reader)
+	if err != nil {
+		t.Fatalf("EncryptBorda failed: %v", err)
+	}
+	// Give candidate 2 the top score as well, reusing candidate 0's row.
+	b.Matrix[2], b.CellProofs[2] = b.Matrix[0], b.CellProofs[0]
+	b.RowProofs[2] = b.RowProofs[0]
+	if err := VerifyBorda(pk, 3, nil, b); err == nil {
+		t.Fatalf("ballot giving two candidates the same score accepted")
+	}
+}
+
+func TestBordaScoresRejectsMalformedMatrix(t *testing.T) {
+	_, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	b, err := EncryptBorda(pk, []int{0, 1, 2}, nil, rand.Reader)
+	if err != nil {
+		t.Fatalf("EncryptBorda failed: %v", err)
+	}
+	full := b.Matrix
+	for _, matrix := range [][][]*Ciphertext{
+		nil,
+		{full[0][:2], full[1][:2], full[2][:2]}, // Short rows
+		{full[0], full[1][:2], full[2]},         // Ragged
+		{full[0], full[1]},                      // Fewer rows than scores
+	} {
+		b.Matrix = matrix
+		if _, err := b.Scores(); err == nil {
+			t.Fatalf("Scores accepted a %d-row malformed matrix", len(matrix))
+		}
+	}
+}
+
+func TestCondorcetTally(t *testing.T) {
+	sk, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	const k = 3
+	rankings := [][]int{{0, 1, 2}, {1, 0, 2}, {0, 2, 1}}
+	want := make([][]uint64, k)
+	for i := range want {
+		want[i] = make([]uint64, k)
+	}
+	ballots := make([]*CondorcetBallot, len(rankings))
+	for n, ranking := range rankings {
+		if ballots[n], err = EncryptCondorcet(pk, ranking, nil, rand.Reader); err != nil {
+			t.Fatalf("EncryptCondorcet failed: %v", err)
+		}
+		if err := VerifyCondorcet(pk, k, nil, ballots[n]); err != nil {
+			t.Fatalf("valid Condorcet ballot rejected: %v", err)
+		}
+		for p, i := range ranking {
+			for _, j := range ranking[p+1:] {
+				want[i][j]++
+			}
+		}
+	}
+
+	sum, err := SumPreferences(pk.Prec, ballots...)
+	if err != nil {
+		t.Fatalf("SumPreferences failed: %v", err)
+	}
+	got, err := DecryptPreferences(sk, sum)
+	if err != nil {
+		t.Fatalf("DecryptPreferences failed: %v", err)
+	}
+	for i := range k {
+		if !slices.Equal(got[i], want[i]) {
+			t.Fatalf("preference matrix: got %v, want %v", got, want)
+		}
+	}
+	if w, ok := CondorcetWinner(got); !ok || w != 0 {
+		t.Fatalf("Condorcet winner: got %d (%v), want 0", w, ok)
+	}
+	if w := SchulzeWinners(got); !slices.Equal(w, []int{0}) {
+		t.Fatalf("Schulze winners: got %v, want [0]", w)
+	}
+}
+
+func TestCondorcetRejectsCycle(t *testing.T) {
+	_, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	b, err := EncryptCondorcet(pk, []int{0, 1, 2}, nil, rand.Reader)
+	if err != nil {
+		t.Fatalf("EncryptCondorcet failed: %v", err)
+	}
+	// Flip 0 > 2 into 2 > 0, giving the cycle 0 > 1 > 2 > 0. Every cell and
+	// pair proof still holds; only the out-degree proofs catch it.
+	b.Preferences[0][2], b.Preferences[2][0] = b.Preferences[2][0], b.Preferences[0][2]
+	b.CellProofs[0][2], b.CellProofs[2][0] = b.CellProofs[2][0], b.CellProofs[0][2]
+	if err := VerifyCondorcet(pk, 3, nil, b); err == nil {
+		t.Fatalf("cyclic preferences accepted")
+	}
+}
+
+func TestSchulzeResolvesCycle(t *testing.T) {
+	// 0 beats 1 (6-3), 1 beats 2 (7-2), 2 beats 0 (5-4): no Condorcet winner.
+	d := [][]uint64{
+		{0, 6, 4},
+		{3, 0, 7},
+		{5, 2, 0},
+	}
+	if _, ok := CondorcetWinner(d); ok {
+		t.Fatalf("Condorcet winner found in a cycle")
+	}
+	if w := SchulzeWinners(d); !slices.Equal(w, []int{0}) {
+		t.Fatalf("Schulze winners: got %v, want [0]", w)
+	}
+}
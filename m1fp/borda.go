@@ -0,0 +1,196 @@
+package m1fp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// exactlyOne is the range of every row and column sum of a permutation matrix.
+var exactlyOne = VoteRange{Min: 1, Max: 1}
+
+// BordaBallot is a Borda count ballot over k candidates. It encrypts a k×k
+// permutation matrix where Matrix[c][s] is 1 if candidate c receives s
+// points and 0 otherwise. The proofs show that every cell is 0 or 1, that
+// every candidate receives exactly one score and that every score in
+// {0..k-1} is given exactly once, i.e. the scores form a permutation.
+//
+// The encrypted score of candidate c is Σ_s s · Matrix[c][s], computed
+// homomorphically by Scores, so it needs no proof of its own.
+type BordaBallot struct {
+	Context      []byte // Election context the proofs are bound to
+	Matrix       [][]*Ciphertext
+	CellProofs   [][]*RangeProof
+	RowProofs    []*RangeProof // Candidate c receives exactly one score
+	ColumnProofs []*RangeProof // Score s is given to exactly one candidate
+}
+
+// EncryptBorda encrypts a Borda ballot for ranking, which lists every
+// candidate index once from most to least preferred. With k candidates the
+// first one receives k-1 points and the last one 0. The proofs are bound to
+// context, typically the manifest hash. Randomness is read from random.
+func EncryptBorda(pk *PublicKey, ranking []int, context []byte, random io.Reader) (*BordaBallot, error) {
+	b, _, err := encryptBordaOpen(pk, ranking, context, random)
+	return b, err
+}
+
+// encryptBordaOpen is EncryptBorda also returning the randomness of every
+// matrix cell, for proofs that build on the Borda scores.
+func encryptBordaOpen(pk *PublicKey, ranking []int, context []byte, random io.Reader) (*BordaBallot, [][]*big.Int, error) {
+	k := len(ranking)
+	if k < 2 {
+		return nil, nil, fmt.Errorf("borda ballot needs at least two candidates")
+	}
+	points := make([]int, k)
+	for i := range points {
+		points[i] = -1
+	}
+	for pos, c := range ranking {
+		if c < 0 || c >= k || points[c] >= 0 {
+			return nil, nil, fmt.Errorf("ranking is not a permutation of %d candidates", k)
+		}
+		points[c] = k - 1 - pos
+	}
+
+	b := &BordaBallot{
+		Context:      bytes.Clone(context),
+		Matrix:       make([][]*Ciphertext, k),
+		CellProofs:   make([][]*RangeProof, k),
+		RowProofs:    make([]*RangeProof, k),
+		ColumnProofs: make([]*RangeProof, k),
+	}
+	rs := make([][]*big.Int, k)
+	for c := range k {
+		b.Matrix[c] = make([]*Ciphertext, k)
+		b.CellProofs[c] = make([]*RangeProof, k)
+		rs[c] = make([]*big.Int, k)
+		for s := range k {
+			var v uint64
+			if points[c] == s {
+				v = 1
+			}
+			ct, r, err := encryptVoteRandom(pk, v, random)
+			if err != nil {
+				return nil, nil, err
+			}
+			if b.CellProofs[c][s], err = proveRange(pk, ct, v, r, RandomnessBits, VoteRange{Min: 0, Max: 1}, context, random); err != nil {
+				return nil, nil, err
+			}
+			b.Matrix[c][s], rs[c][s] = ct, r
+		}
+	}
+
+	for i := range k {
+		row, rowRand := b.row(i), new(big.Int)
+		col, colRand := b.column(i), new(big.Int)
+		for j := range k {
+			rowRand.Add(rowRand, rs[i][j])
+			colRand.Add(colRand, rs[j][i])
+		}
+		var err error
+		if b.RowProofs[i], err = proveSum(pk, row, rowRand, context, random); err != nil {
+			return nil, nil, err
+		}
+		if b.ColumnProofs[i], err = proveSum(pk, col, colRand, context, random); err != nil {
+			return nil, nil, err
+		}
+	}
+	return b, rs, nil
+}
+
+// VerifyBorda checks that b is a valid Borda ballot over k candidates whose
+// proofs are bound to context.
+func VerifyBorda(pk *PublicKey, k int, context []byte, b *BordaBallot) error {
+	if b == nil || len(b.Matrix) != k || len(b.CellProofs) != k || len(b.RowProofs) != k || len(b.ColumnProofs) != k {
+		return fmt.Errorf("borda ballot must cover %d candidates", k)
+	}
+	if !bytes.Equal(b.Context, context) {
+		return fmt.Errorf("ballot belongs to another election context")
+	}
+	for c := range k {
+		if len(b.Matrix[c]) != k || len(b.CellProofs[c]) != k {
+			return fmt.Errorf("candidate %d: borda ballot must have %d scores", c, k)
+		}
+		for s := range k {
+			if err := verifyRange(pk, b.Matrix[c][s], RandomnessBits, VoteRange{Min: 0, Max: 1}, context, b.CellProofs[c][s]); err != nil {
+				return fmt.Errorf("candidate %d, score %d: %w", c, s, err)
+			}
+		}
+	}
+	for i := range k {
+		if err := verifySum(pk, b.row(i), context, b.RowProofs[i]); err != nil {
+			return fmt.Errorf("candidate %d: %w", i, err)
+		}
+		if err := verifySum(pk, b.column(i), context, b.ColumnProofs[i]); err != nil {
+			return fmt.Errorf("score %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Scores returns the encrypted Borda score of every candidate, to be added
+// to a TallyVector with AddEntries. The ballot must have been verified; a
+// matrix that is not k×k is rejected rather than read out of bounds.
+func (b *BordaBallot) Scores() ([]*Ciphertext, error) {
+	if b == nil || len(b.Matrix) == 0 {
+		return nil, fmt.Errorf("empty borda ballot")
+	}
+	k := len(b.Matrix)
+	for c, row := range b.Matrix {
+		if len(row) != k {
+			return nil, fmt.Errorf("candidate %d: borda ballot must have %d scores", c, k)
+		}
+	}
+	scores := make([]*Ciphertext, k)
+	for c := range k {
+		terms := make([]*Ciphertext, k)
+		for s := range k {
+			var err error
+			if terms[s], err = b.Matrix[c][s].MulScalar(big.NewInt(int64(s))); err != nil {
+				return nil, fmt.Errorf("candidate %d: %w", c, err)
+			}
+		}
+		var err error
+		if scores[c], err = AddMany(0, terms...); err != nil {
+			return nil, fmt.Errorf("candidate %d: %w", c, err)
+		}
+	}
+	return scores, nil
+}
+
+// row returns the cells of candidate c.
+func (b *BordaBallot) row(c int) []*Ciphertext {
+	return b.Matrix[c]
+}
+
+// column returns the cells holding score s.
+func (b *BordaBallot) column(s int) []*Ciphertext {
+	col := make([]*Ciphertext, len(b.Matrix))
+	for c := range b.Matrix {
+		col[c] = b.Matrix[c][s]
+	}
+	return col
+}
+
+// proveSum proves that the homomorphic sum of cts, whose randomness adds up
+// to rSum, encrypts exactly 1.
+func proveSum(pk *PublicKey, cts []*Ciphertext, rSum *big.Int, context []byte, random io.Reader) (*RangeProof, error) {
+	sum, err := AddMany(pk.Prec, cts...)
+	if err != nil {
+		return nil, err
+	}
+	return proveRange(pk, sum, 1, rSum, sumBits(len(cts)), exactlyOne, context, random)
+}
+
+// verifySum checks a proof produced by proveSum.
+func verifySum(pk *PublicKey, cts []*Ciphertext, context []byte, proof *RangeProof) error {
+	sum, err := AddMany(pk.Prec, cts...)
+	if err != nil {
+		return err
+	}
+	if err := verifyRange(pk, sum, sumBits(len(cts)), exactlyOne, context, proof); err != nil {
+		return fmt.Errorf("sum: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,286 @@
+package m1fp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// CondorcetBallot encrypts the pairwise-preference matrix of a strict
+// ranking over k candidates: Preferences[i][j] is 1 if candidate i is ranked
+// above candidate j and 0 otherwise, so that summing ballots cell by cell
+// yields the pairwise-preference matrix of the electorate without revealing
+// any individual ranking.
+//
+// A 0/1 matrix comes from a strict ranking exactly when it is a tournament
+// (P[i][j] + P[j][i] = 1 for i ≠ j, zero diagonal) whose out-degrees are a
+// permutation of {0..k-1}. The ballot proves the first part directly and the
+// second part by embedding a BordaBallot, whose score of candidate i must
+// equal the row sum of i.
+type CondorcetBallot struct {
+	Context      []byte // Election context the proofs are bound to
+	Preferences  [][]*Ciphertext
+	CellProofs   [][]*RangeProof // Off-diagonal cells are 0 or 1, diagonal cells are 0
+	PairProofs   [][]*RangeProof // PairProofs[i][j] for i < j: P[i][j] + P[j][i] = 1
+	Ranking      *BordaBallot    // Permutation of the out-degrees
+	DegreeProofs []*RangeProof   // Row sum of i minus its Borda score encrypts 0
+}
+
+// EncryptCondorcet encrypts the pairwise preferences of ranking, which lists
+// every candidate index once from most to least preferred. The proofs are
+// bound to context, typically the manifest hash. Randomness is read from random.
+func EncryptCondorcet(pk *PublicKey, ranking []int, context []byte, random io.Reader) (*CondorcetBallot, error) {
+	k := len(ranking)
+	ranked, bordaRand, err := encryptBordaOpen(pk, ranking, context, random)
+	if err != nil {
+		return nil, err
+	}
+	pos := make([]int, k)
+	for p, c := range ranking {
+		pos[c] = p
+	}
+
+	b := &CondorcetBallot{
+		Context:      bytes.Clone(context),
+		Preferences:  make([][]*Ciphertext, k),
+		CellProofs:   make([][]*RangeProof, k),
+		PairProofs:   make([][]*RangeProof, k),
+		Ranking:      ranked,
+		DegreeProofs: make([]*RangeProof, k),
+	}
+	rs := make([][]*big.Int, k)
+	for i := range k {
+		b.Preferences[i] = make([]*Ciphertext, k)
+		b.CellProofs[i] = make([]*RangeProof, k)
+		b.PairProofs[i] = make([]*RangeProof, k)
+		rs[i] = make([]*big.Int, k)
+		for j := range k {
+			var v uint64
+			if pos[i] < pos[j] {
+				v = 1
+			}
+			ct, r, err := encryptVoteRandom(pk, v, random)
+			if err != nil {
+				return nil, err
+			}
+			if b.CellProofs[i][j], err = proveRange(pk, ct, v, r, RandomnessBits, cellRange(i, j), context, random); err != nil {
+				return nil, err
+			}
+			b.Preferences[i][j], rs[i][j] = ct, r
+		}
+	}
+
+	for i := range k {
+		for j := i + 1; j < k; j++ {
+			pair := []*Ciphertext{b.Preferences[i][j], b.Preferences[j][i]}
+			if b.PairProofs[i][j], err = proveSum(pk, pair, new(big.Int).Add(rs[i][j], rs[j][i]), context, random); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	diffs, err := b.degreeDifferences()
+	if err != nil {
+		return nil, err
+	}
+	for i, diff := range diffs {
+		r := new(big.Int)
+		for j := range k {
+			r.Add(r, rs[i][j])
+		}
+		for s := range k {
+			r.Sub(r, new(big.Int).Mul(big.NewInt(int64(s)), bordaRand[i][s]))
+		}
+		if b.DegreeProofs[i], err = proveRange(pk, diff, 0, r, degreeBits(k), VoteRange{Min: 0, Max: 0}, context, random); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// VerifyCondorcet checks that b is a valid Condorcet ballot over k candidates
+// whose proofs are bound to context.
+func VerifyCondorcet(pk *PublicKey, k int, context []byte, b *CondorcetBallot) error {
+	if b == nil || len(b.Preferences) != k || len(b.CellProofs) != k || len(b.PairProofs) != k || len(b.DegreeProofs) != k {
+		return fmt.Errorf("condorcet ballot must cover %d candidates", k)
+	}
+	if !bytes.Equal(b.Context, context) {
+		return fmt.Errorf("ballot belongs to another election context")
+	}
+	for i := range k {
+		if len(b.Preferences[i]) != k || len(b.CellProofs[i]) != k || len(b.PairProofs[i]) != k {
+			return fmt.Errorf("candidate %d: condorcet ballot must have %d preferences", i, k)
+		}
+		for j := range k {
+			if err := verifyRange(pk, b.Preferences[i][j], RandomnessBits, cellRange(i, j), context, b.CellProofs[i][j]); err != nil {
+				return fmt.Errorf("preference %d over %d: %w", i, j, err)
+			}
+		}
+	}
+	for i := range k {
+		for j := i + 1; j < k; j++ {
+			pair := []*Ciphertext{b.Preferences[i][j], b.Preferences[j][i]}
+			if err := verifySum(pk, pair, context, b.PairProofs[i][j]); err != nil {
+				return fmt.Errorf("pair %d, %d: %w", i, j, err)
+			}
+		}
+	}
+
+	if err := VerifyBorda(pk, k, context, b.Ranking); err != nil {
+		return fmt.Errorf("ranking: %w", err)
+	}
+	diffs, err := b.degreeDifferences()
+	if err != nil {
+		return err
+	}
+	for i, diff := range diffs {
+		if err := verifyRange(pk, diff, degreeBits(k), VoteRange{Min: 0, Max: 0}, context, b.DegreeProofs[i]); err != nil {
+			return fmt.Errorf("candidate %d out-degree: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// SumPreferences adds verified Condorcet ballots cell by cell with AddMany,
+// returning the encrypted pairwise-preference matrix of the electorate.
+func SumPreferences(prec uint16, ballots ...*CondorcetBallot) ([][]*Ciphertext, error) {
+	if len(ballots) == 0 {
+		return nil, fmt.Errorf("no ballots")
+	}
+	k := len(ballots[0].Preferences)
+	sum := make([][]*Ciphertext, k)
+	cell := make([]*Ciphertext, len(ballots))
+	for i := range k {
+		sum[i] = make([]*Ciphertext, k)
+		for j := range k {
+			for n, b := range ballots {
+				if len(b.Preferences) != k || len(b.Preferences[i]) != k {
+					return nil, fmt.Errorf("ballot %d: condorcet ballot must cover %d candidates", n, k)
+				}
+				cell[n] = b.Preferences[i][j]
+			}
+			var err error
+			if sum[i][j], err = AddMany(prec, cell...); err != nil {
+				return nil, fmt.Errorf("preference %d over %d: %w", i, j, err)
+			}
+		}
+	}
+	return sum, nil
+}
+
+// DecryptPreferences decrypts a summed preference matrix with DecryptVote.
+// Entry [i][j] is the number of voters ranking i above j.
+func DecryptPreferences(sk *PrivateKey, matrix [][]*Ciphertext) ([][]uint64, error) {
+	d := make([][]uint64, len(matrix))
+	for i, row := range matrix {
+		d[i] = make([]uint64, len(row))
+		for j, ct := range row {
+			v, err := DecryptVote(sk, ct)
+			if err != nil {
+				return nil, fmt.Errorf("preference %d over %d: %w", i, j, err)
+			}
+			d[i][j] = v
+		}
+	}
+	return d, nil
+}
+
+// CondorcetWinner returns the candidate preferred over every other candidate
+// by a strict majority of the pairwise matrix d, if there is one.
+func CondorcetWinner(d [][]uint64) (int, bool) {
+	for i := range d {
+		wins := true
+		for j := range d {
+			if i != j && d[i][j] <= d[j][i] {
+				wins = false
+				break
+			}
+		}
+		if wins {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// SchulzeWinners returns the winners of the Schulze method on the pairwise
+// matrix d: the candidates whose strongest path to every other candidate is
+// at least as strong as the reverse one. It always contains the Condorcet
+// winner when one exists, and holds several candidates only on ties.
+func SchulzeWinners(d [][]uint64) []int {
+	k := len(d)
+	p := make([][]uint64, k)
+	for i := range k {
+		p[i] = make([]uint64, k)
+		for j := range k {
+			if i != j && d[i][j] > d[j][i] {
+				p[i][j] = d[i][j]
+			}
+		}
+	}
+	for m := range k {
+		for i := range k {
+			if i == m {
+				continue
+			}
+			for j := range k {
+				if j == i || j == m {
+					continue
+				}
+				p[i][j] = max(p[i][j], min(p[i][m], p[m][j]))
+			}
+		}
+	}
+
+	var winners []int
+	for i := range k {
+		beaten := false
+		for j := range k {
+			if i != j && p[j][i] > p[i][j] {
+				beaten = true
+				break
+			}
+		}
+		if !beaten {
+			winners = append(winners, i)
+		}
+	}
+	return winners
+}
+
+// degreeDifferences returns, for every candidate i, the ciphertext
+// Σ_j P[i][j] - Σ_s s · R[i][s], which encrypts 0 when the out-degree of i
+// equals its Borda score.
+func (b *CondorcetBallot) degreeDifferences() ([]*Ciphertext, error) {
+	scores, err := b.Ranking.Scores()
+	if err != nil {
+		return nil, err
+	}
+	diffs := make([]*Ciphertext, len(scores))
+	for i := range diffs {
+		degree, err := AddMany(0, b.Preferences[i]...)
+		if err != nil {
+			return nil, fmt.Errorf("candidate %d: %w", i, err)
+		}
+		if diffs[i], err = degree.Sub(scores[i], 0); err != nil {
+			return nil, fmt.Errorf("candidate %d: %w", i, err)
+		}
+	}
+	return diffs, nil
+}
+
+// cellRange returns the allowed values of preference cell (i, j).
+func cellRange(i, j int) VoteRange {
+	if i == j {
+		return VoteRange{Min: 0, Max: 0}
+	}
+	return VoteRange{Min: 0, Max: 1}
+}
+
+// degreeBits bounds the randomness of an out-degree difference over k
+// candidates: k preference factors plus Borda factors weighted by scores up
+// to k-1, less than k² factors below 2^RandomnessBits in all.
+func degreeBits(k int) uint {
+	return sumBits(k * k)
+}
@@ -10,6 +10,7 @@ package m1fp
 import (
 	"crypto/rand"
 	"fmt"
+	"io"
 	"math/big"
 	"strings"
 )
@@ -18,6 +19,32 @@ import (
 // This represents ln(5) mod 1 with high precision.
 const X = "0.6094379124341003746007593332261876395256013542685177219126478914741789877076578"
 
+// RandomnessBits is the size of the encryption randomness r.
+//
+// Decryption recovers M · 2^(P-n) - r · e, where e = a · X - H mod D is the
+// rounding error left by lifting h = a · x mod 1 into the common domain
+// (about 2^150 at 256-bit precision). The noise term must stay below half
+// the scale factor 2^(P-n), so the randomness accumulated over a tally is
+// bounded: 64-bit factors leave room for about 2^30 homomorphic additions
+// or re-randomizations before decryption starts to drift.
+const RandomnessBits = 64
+
+// NoiseBits returns the size, in bits, up to which the randomness R of an
+// n-digit ciphertext under pk may grow while it still decrypts correctly.
+// For keys from KeyGen, whose secret a is below 2^128, the rounding error
+// e = a · X - H mod D stays below 2^(129 + bits(D) - P), so |R| < 2^b with
+// b = NoiseBits(n) keeps the noise R · e below half the scale factor
+// 2^(P-n). The result is negative if no randomness fits.
+func (pk *PublicKey) NoiseBits(n int) int {
+	return noiseBits(pk.D, pk.Prec, n)
+}
+
+// noiseBits is NoiseBits for the common domain d = 2^prec · 5^digits.
+func noiseBits(d *big.Int, prec uint16, n int) int {
+	eBits := 129 + d.BitLen() - int(prec)
+	return int(prec) - n - 1 - eBits
+}
+
 // PrivateKey contains the secret key material for M1FP encryption.
 // The secret integer A is never exposed outside this structure.
 type PrivateKey struct {
@@ -109,17 +136,29 @@ func (ct *Ciphertext) GetDigitCount() int {
 	return int(ct.n)
 }
 
+// CheckDomain returns an error unless ct is a complete ciphertext in the
+// common domain of pk, so that it can be added to other ciphertexts under pk.
+func (pk *PublicKey) CheckDomain(ct *Ciphertext) error {
+	if pk == nil || pk.D == nil {
+		return fmt.Errorf("invalid public key")
+	}
+	if ct == nil || ct.c1 == nil || ct.c2 == nil || ct.d == nil {
+		return fmt.Errorf("nil ciphertext")
+	}
+	if ct.d.Cmp(pk.D) != 0 {
+		return fmt.Errorf("mismatched common denominators")
+	}
+	return nil
+}
+
 // Encrypt encodes a message using probabilistic encryption.
 // The message m should contain ASCII or UTF-8 characters with byte values 0-255.
 // Returns the ciphertext, the random value used (for testing), and any error.
 func Encrypt(pk *PublicKey, m string) (*Ciphertext, *big.Int, error) {
-	r, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	r, err := randomFactor(rand.Reader)
 	if err != nil {
 		return nil, nil, err
 	}
-	if r.Sign() == 0 {
-		r.Add(r, big.NewInt(1))
-	}
 
 	c, err := EncryptDeterministic(pk, m, r)
 	return c, r, err
@@ -183,10 +222,24 @@ func Decrypt(sk *PrivateKey, ct *Ciphertext) (string, error) {
 		}
 	}
 
+	messageInt.Mod(messageInt, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil))
+
 	msgDigits := fmt.Sprintf("%0*d", int(n), messageInt)
 	return digitsToASCII(msgDigits)
 }
 
+// randomFactor draws a non-zero encryption randomness r < 2^RandomnessBits.
+func randomFactor(random io.Reader) (*big.Int, error) {
+	r, err := rand.Int(random, new(big.Int).Lsh(big.NewInt(1), RandomnessBits))
+	if err != nil {
+		return nil, err
+	}
+	if r.Sign() == 0 {
+		r.Add(r, big.NewInt(1))
+	}
+	return r, nil
+}
+
 // mulIntFloatMod1 computes (a * x) mod 1 with the specified precision.
 // Used internally for key generation to compute h = (a * x) mod 1.
 func mulIntFloatMod1(a *big.Int, x *big.Float, prec uint16) *big.Float {
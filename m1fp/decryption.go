@@ -0,0 +1,130 @@
+package m1fp
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/p4u/m1fp-go/transcript"
+)
+
+// DecryptionProof shows that a vote ciphertext decrypts to a claimed value
+// without revealing the secret key.
+//
+// Decryption computes M' = C2 - a · C1 = M · S - R · e (mod D), where R is
+// the accumulated randomness of the ciphertext and e = a · X - H the key
+// rounding error. Knowing a, the key holder recovers R = (M · S - M') / e
+// and proves in zero knowledge, with the single-branch form of the range
+// proof, that (C1, C2 - M · S) = R · (X, H) for some |R| < 2^decryptionBits,
+// i.e. that the ciphertext is an encryption of M with randomness R. Any such
+// ciphertext within the noise budget decrypts to M.
+//
+// The proof is sound because R is bounded: two openings of the same C1 differ
+// by a multiple of D / gcd(X, D), far above the bound, so (M, R) is the only
+// small opening of the ciphertext. A tally of proven ballots, whose openings
+// add up to (Σ m_i, Σ r_i), can therefore only be proven to decrypt to the
+// sum of their votes.
+type DecryptionProof struct {
+	Challenge *big.Int   `json:"challenge"`
+	Responses []*big.Int `json:"responses"`
+}
+
+// decryptionBits bounds the randomness of a decrypted tally. It covers the
+// whole noise budget, so every ciphertext that decrypts correctly can be
+// proven.
+const decryptionBits = 2 * RandomnessBits
+
+// ProveDecryption decrypts ct with DecryptVote and proves the result.
+// Randomness for the proof is read from random.
+func ProveDecryption(sk *PrivateKey, ct *Ciphertext, random io.Reader) (uint64, *DecryptionProof, error) {
+	pk := &sk.PK
+	if err := checkVoteCiphertext(pk, ct); err != nil {
+		return 0, nil, err
+	}
+	m, err := DecryptVote(sk, ct)
+	if err != nil {
+		return 0, nil, err
+	}
+	r, err := recoverRandomness(sk, ct, m)
+	if err != nil {
+		return 0, nil, err
+	}
+	p, err := proveDisjunction(decryptionTranscript(pk, ct, m), pk, ct, []uint64{m}, 0, r, decryptionBits, random)
+	if err != nil {
+		return 0, nil, err
+	}
+	return m, &DecryptionProof{Challenge: p.Challenges[0], Responses: p.Responses[0]}, nil
+}
+
+// VerifyDecryption checks that ct decrypts to m under pk.
+func VerifyDecryption(pk *PublicKey, ct *Ciphertext, m uint64, proof *DecryptionProof) error {
+	if err := checkVoteCiphertext(pk, ct); err != nil {
+		return err
+	}
+	if m >= VoteMod {
+		return fmt.Errorf("plaintext %d out of range", m)
+	}
+	if proof == nil {
+		return fmt.Errorf("missing decryption proof")
+	}
+	if err := checkUniqueOpening(pk); err != nil {
+		return err
+	}
+	p := &RangeProof{Challenges: []*big.Int{proof.Challenge}, Responses: [][]*big.Int{proof.Responses}}
+	if err := verifyDisjunction(decryptionTranscript(pk, ct, m), pk, ct, []uint64{m}, decryptionBits, p); err != nil {
+		return fmt.Errorf("decryption proof: %w", err)
+	}
+	return nil
+}
+
+// recoverRandomness returns the R with ct = encryptInt(pk, m, R), using the
+// secret key to strip the decryption noise R · e.
+func recoverRandomness(sk *PrivateKey, ct *Ciphertext, m uint64) (*big.Int, error) {
+	pk := &sk.PK
+	e := mulMod(sk.A, pk.XInt, pk.D)
+	e.Sub(e, pk.HInt)
+	e = signedMod(e, pk.D)
+	if e.Sign() == 0 {
+		return nil, fmt.Errorf("degenerate key")
+	}
+
+	mPrime := new(big.Int).Sub(ct.c2, mulMod(sk.A, ct.c1, pk.D))
+	noise := new(big.Int).Mul(new(big.Int).SetUint64(m), voteScale(pk))
+	noise = signedMod(noise.Sub(noise, mPrime), pk.D)
+
+	r, rem := new(big.Int).QuoRem(noise, e, new(big.Int))
+	if rem.Sign() != 0 || mulMod(r, pk.XInt, pk.D).Cmp(ct.c1) != 0 {
+		return nil, fmt.Errorf("ciphertext randomness exceeds the noise budget")
+	}
+	return r, nil
+}
+
+// checkUniqueOpening checks that pk binds the randomness of the openings a
+// decryption proof can extract, which are below 2^(decryptionBits+slackBits)
+// in absolute value: openings of the same C1 differ by multiples of
+// D / gcd(X, D), which must exceed twice that bound.
+func checkUniqueOpening(pk *PublicKey) error {
+	period := new(big.Int).GCD(nil, nil, pk.XInt, pk.D)
+	period.Div(pk.D, period)
+	if period.BitLen() <= decryptionBits+slackBits+1 {
+		return fmt.Errorf("public key does not bind ciphertext randomness")
+	}
+	return nil
+}
+
+// signedMod reduces v modulo d into (-d/2, d/2].
+func signedMod(v, d *big.Int) *big.Int {
+	v = new(big.Int).Mod(v, d)
+	if new(big.Int).Lsh(v, 1).Cmp(d) > 0 {
+		v.Sub(v, d)
+	}
+	return v
+}
+
+// decryptionTranscript absorbs the statement of a decryption proof.
+func decryptionTranscript(pk *PublicKey, ct *Ciphertext, m uint64) *transcript.Transcript {
+	t := newTranscript("m1fp/decryption-proof", pk)
+	t.AppendCiphertext("ciphertext", ct)
+	t.AppendUint64("plaintext", m)
+	return t
+}
@@ -0,0 +1,133 @@
+package m1fp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func TestDecryptionProof(t *testing.T) {
+	sk, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	var cts []*Ciphertext
+	for _, v := range []uint64{5, 0, 64, 17} {
+		ct, _, err := EncryptVote(pk, v, nil)
+		if err != nil {
+			t.Fatalf("EncryptVote failed: %v", err)
+		}
+		cts = append(cts, ct)
+	}
+	sum, err := AddMany(pk.Prec, cts...)
+	if err != nil {
+		t.Fatalf("AddMany failed: %v", err)
+	}
+	diff, err := cts[0].Sub(cts[3], pk.Prec)
+	if err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+
+	for _, ct := range []*Ciphertext{cts[1], sum, diff} {
+		m, proof, err := ProveDecryption(sk, ct, rand.Reader)
+		if err != nil {
+			t.Fatalf("ProveDecryption failed: %v", err)
+		}
+		if want, _ := DecryptVote(sk, ct); m != want {
+			t.Fatalf("ProveDecryption returned %d, DecryptVote %d", m, want)
+		}
+		if err := VerifyDecryption(pk, ct, m, proof); err != nil {
+			t.Fatalf("honest decryption rejected: %v", err)
+		}
+		if err := VerifyDecryption(pk, ct, (m+1)%VoteMod, proof); err == nil {
+			t.Fatalf("decryption to %d accepted for a ciphertext of %d", m+1, m)
+		}
+	}
+
+	m, proof, err := ProveDecryption(sk, sum, rand.Reader)
+	if err != nil {
+		t.Fatalf("ProveDecryption failed: %v", err)
+	}
+	data, err := json.Marshal(proof)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte(`{"challenge":"`)) {
+		t.Fatalf("proof integers not encoded as strings: %s", data)
+	}
+	decoded := new(DecryptionProof)
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if err := VerifyDecryption(pk, sum, m, decoded); err != nil {
+		t.Fatalf("decoded decryption proof rejected: %v", err)
+	}
+	proof.Responses[7] = new(big.Int).Add(proof.Responses[7], big.NewInt(1))
+	if err := VerifyDecryption(pk, sum, m, proof); err == nil {
+		t.Fatalf("tampered decryption proof accepted")
+	}
+}
+
+func TestDecryptionProofRejectsForgedTally(t *testing.T) {
+	sk, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	var cts []*Ciphertext
+	var r big.Int
+	for _, v := range []uint64{20, 30} {
+		ct, rv, err := EncryptVote(pk, v, nil)
+		if err != nil {
+			t.Fatalf("EncryptVote failed: %v", err)
+		}
+		cts = append(cts, ct)
+		r.Add(&r, rv)
+	}
+	sum, err := AddMany(pk.Prec, cts...)
+	if err != nil {
+		t.Fatalf("AddMany failed: %v", err)
+	}
+
+	// A dishonest authority claims 100000050 for a tally of 50, grinding the
+	// challenge like the forgery of the former single-challenge proof.
+	const claim = 100000050
+	offset := new(big.Int).Mul(big.NewInt(claim-50), voteScale(pk))
+	offset.Neg(offset)
+	for attempt := range 256 {
+		p, err := forgeDisjunction(decryptionTranscript(pk, sum, claim), pk, sum, []uint64{claim}, 0, offset, &r, decryptionBits)
+		if err != nil {
+			t.Fatalf("forgeDisjunction failed: %v", err)
+		}
+		proof := &DecryptionProof{Challenge: p.Challenges[0], Responses: p.Responses[0]}
+		if err := VerifyDecryption(pk, sum, claim, proof); err == nil {
+			t.Fatalf("forged tally %d accepted after %d attempts", claim, attempt+1)
+		}
+	}
+
+	// Randomness shifted by D / gcd(X, D) still opens C1, but is too large
+	// to be proven.
+	wide := new(big.Int).Div(pk.D, new(big.Int).GCD(nil, nil, pk.XInt, pk.D))
+	wide.Add(wide, &r)
+	p, err := proveDisjunction(decryptionTranscript(pk, sum, 50), pk, sum, []uint64{50}, 0, wide, uint(wide.BitLen()), rand.Reader)
+	if err != nil {
+		t.Fatalf("proveDisjunction failed: %v", err)
+	}
+	if err := VerifyDecryption(pk, sum, 50, &DecryptionProof{Challenge: p.Challenges[0], Responses: p.Responses[0]}); err == nil {
+		t.Fatalf("decryption proof with a %d-bit opening accepted", wide.BitLen())
+	}
+
+	m, proof, err := ProveDecryption(sk, sum, rand.Reader)
+	if err != nil {
+		t.Fatalf("ProveDecryption failed: %v", err)
+	}
+	if m != 50 {
+		t.Fatalf("tally decrypted to %d, want 50", m)
+	}
+	if err := VerifyDecryption(pk, sum, claim, proof); err == nil {
+		t.Fatalf("honest proof accepted for the forged tally")
+	}
+}
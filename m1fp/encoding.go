@@ -0,0 +1,210 @@
+package m1fp
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// MarshalBinary encodes the ciphertext together with the parameters of its
+// common domain, so that it can be decoded and added without the public key.
+func (ct *Ciphertext) MarshalBinary() ([]byte, error) {
+	if ct == nil || ct.c1 == nil || ct.c2 == nil || ct.d == nil {
+		return nil, errors.New("nil receiver or fields")
+	}
+	prec, digits, ok := domainParameters(ct.d)
+	if !ok {
+		return nil, errors.New("unsupported common denominator")
+	}
+	if ct.n > 1<<16-1 {
+		return nil, errors.New("unsupported digit count")
+	}
+
+	c1 := ct.c1.Bytes()
+	c2 := ct.c2.Bytes()
+
+	// Format: [prec:2][digits:2][n:2][c1Len:4][c1][c2Len:4][c2]
+	buf := make([]byte, 14+len(c1)+len(c2))
+	binary.BigEndian.PutUint16(buf[0:2], prec)
+	binary.BigEndian.PutUint16(buf[2:4], digits)
+	binary.BigEndian.PutUint16(buf[4:6], uint16(ct.n))
+	binary.BigEndian.PutUint32(buf[6:10], uint32(len(c1)))
+	copy(buf[10:], c1)
+	binary.BigEndian.PutUint32(buf[10+len(c1):], uint32(len(c2)))
+	copy(buf[14+len(c1):], c2)
+
+	return buf, nil
+}
+
+// UnmarshalBinary decodes a ciphertext produced by MarshalBinary. The common
+// denominator is recomputed from the encoded precision and digits, and both
+// components must be reduced modulo it.
+func (ct *Ciphertext) UnmarshalBinary(data []byte) error {
+	if len(data) < 10 {
+		return errors.New("truncated input")
+	}
+	prec := binary.BigEndian.Uint16(data[0:2])
+	digits := binary.BigEndian.Uint16(data[2:4])
+	n := binary.BigEndian.Uint16(data[4:6])
+
+	c1Len := uint64(binary.BigEndian.Uint32(data[6:10]))
+	if uint64(len(data)) < 14+c1Len {
+		return errors.New("truncated input")
+	}
+	c2Len := uint64(binary.BigEndian.Uint32(data[10+c1Len : 14+c1Len]))
+	if uint64(len(data)) != 14+c1Len+c2Len {
+		return errors.New("invalid length")
+	}
+
+	d := computeCommonDenominator(prec, digits)
+	c1 := new(big.Int).SetBytes(data[10 : 10+c1Len])
+	c2 := new(big.Int).SetBytes(data[14+c1Len:])
+	if c1.Cmp(d) >= 0 || c2.Cmp(d) >= 0 {
+		return errors.New("component out of range")
+	}
+
+	*ct = Ciphertext{c1: c1, c2: c2, d: d, n: uint(n)}
+	return nil
+}
+
+// MarshalText encodes the binary form in base64, so that ciphertexts can be
+// embedded in JSON documents.
+func (ct *Ciphertext) MarshalText() ([]byte, error) {
+	b, err := ct.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(base64.StdEncoding.EncodeToString(b)), nil
+}
+
+// UnmarshalText decodes a ciphertext produced by MarshalText.
+func (ct *Ciphertext) UnmarshalText(text []byte) error {
+	b, err := base64.StdEncoding.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	return ct.UnmarshalBinary(b)
+}
+
+// decryptionProofJSON is the JSON form of a DecryptionProof. Its integers
+// are decimal strings, since JSON numbers only carry integers below 2^53
+// exactly.
+type decryptionProofJSON struct {
+	Challenge string   `json:"challenge"`
+	Responses []string `json:"responses"`
+}
+
+// MarshalJSON encodes the proof with its integers as decimal strings.
+func (p *DecryptionProof) MarshalJSON() ([]byte, error) {
+	if p.Challenge == nil {
+		return nil, errors.New("incomplete decryption proof")
+	}
+	enc := decryptionProofJSON{Challenge: p.Challenge.String(), Responses: make([]string, len(p.Responses))}
+	for i, z := range p.Responses {
+		if z == nil {
+			return nil, errors.New("incomplete decryption proof")
+		}
+		enc.Responses[i] = z.String()
+	}
+	return json.Marshal(enc)
+}
+
+// UnmarshalJSON decodes a proof produced by MarshalJSON.
+func (p *DecryptionProof) UnmarshalJSON(data []byte) error {
+	var enc decryptionProofJSON
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return err
+	}
+	challenge, ok := new(big.Int).SetString(enc.Challenge, 10)
+	if !ok {
+		return fmt.Errorf("invalid decryption proof challenge %q", enc.Challenge)
+	}
+	responses := make([]*big.Int, len(enc.Responses))
+	for i, s := range enc.Responses {
+		if responses[i], ok = new(big.Int).SetString(s, 10); !ok {
+			return fmt.Errorf("invalid decryption proof response %q", s)
+		}
+	}
+	*p = DecryptionProof{Challenge: challenge, Responses: responses}
+	return nil
+}
+
+// rangeProofJSON is the JSON form of a RangeProof, with its integers as
+// decimal strings like those of decryptionProofJSON.
+type rangeProofJSON struct {
+	Challenges []string
+	Responses  [][]string
+}
+
+// MarshalJSON encodes the proof with its integers as decimal strings.
+func (p *RangeProof) MarshalJSON() ([]byte, error) {
+	enc := rangeProofJSON{Challenges: make([]string, len(p.Challenges)), Responses: make([][]string, len(p.Responses))}
+	for i, c := range p.Challenges {
+		if c == nil {
+			return nil, errors.New("incomplete range proof")
+		}
+		enc.Challenges[i] = c.String()
+	}
+	for i, row := range p.Responses {
+		enc.Responses[i] = make([]string, len(row))
+		for j, z := range row {
+			if z == nil {
+				return nil, errors.New("incomplete range proof")
+			}
+			enc.Responses[i][j] = z.String()
+		}
+	}
+	return json.Marshal(enc)
+}
+
+// UnmarshalJSON decodes a proof produced by MarshalJSON.
+func (p *RangeProof) UnmarshalJSON(data []byte) error {
+	var enc rangeProofJSON
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return err
+	}
+	var ok bool
+	challenges := make([]*big.Int, len(enc.Challenges))
+	for i, s := range enc.Challenges {
+		if challenges[i], ok = new(big.Int).SetString(s, 10); !ok {
+			return fmt.Errorf("invalid range proof challenge %q", s)
+		}
+	}
+	responses := make([][]*big.Int, len(enc.Responses))
+	for i, row := range enc.Responses {
+		responses[i] = make([]*big.Int, len(row))
+		for j, s := range row {
+			if responses[i][j], ok = new(big.Int).SetString(s, 10); !ok {
+				return fmt.Errorf("invalid range proof response %q", s)
+			}
+		}
+	}
+	*p = RangeProof{Challenges: challenges, Responses: responses}
+	return nil
+}
+
+// domainParameters recovers P and n from a common denominator D = 2^P · 5^n.
+func domainParameters(d *big.Int) (prec, digits uint16, ok bool) {
+	if d.Sign() <= 0 {
+		return 0, 0, false
+	}
+	p := d.TrailingZeroBits()
+	if p > 1<<16-1 {
+		return 0, 0, false
+	}
+	rest := new(big.Int).Rsh(d, p)
+	five := big.NewInt(5)
+	var n uint
+	for rest.Cmp(big.NewInt(1)) > 0 {
+		q, m := new(big.Int).DivMod(rest, five, new(big.Int))
+		if m.Sign() != 0 || n == 1<<16-1 {
+			return 0, 0, false
+		}
+		rest = q
+		n++
+	}
+	return uint16(p), uint16(n), true
+}
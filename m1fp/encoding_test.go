@@ -0,0 +1,66 @@
+package m1fp
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func TestCiphertextEncodingRoundTrip(t *testing.T) {
+	sk, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	ct, _, err := EncryptVote(pk, 7, nil)
+	if err != nil {
+		t.Fatalf("EncryptVote failed: %v", err)
+	}
+	data, err := json.Marshal(struct{ Vote *Ciphertext }{ct})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var decoded struct{ Vote *Ciphertext }
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	other, _, err := EncryptVote(pk, 5, nil)
+	if err != nil {
+		t.Fatalf("EncryptVote failed: %v", err)
+	}
+	sum, err := decoded.Vote.Add(other, pk.Prec)
+	if err != nil {
+		t.Fatalf("Add on decoded ciphertext failed: %v", err)
+	}
+	if v, err := DecryptVote(sk, sum); err != nil || v != 12 {
+		t.Fatalf("decoded sum decrypts to %d (%v), want 12", v, err)
+	}
+}
+
+func TestCiphertextEncodingRejectsMalformed(t *testing.T) {
+	_, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+	ct := encryptInt(pk, big.NewInt(3), big.NewInt(99))
+	b, err := ct.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+
+	var decoded Ciphertext
+	if err := decoded.UnmarshalBinary(b[:len(b)-1]); err == nil {
+		t.Fatalf("truncated ciphertext accepted")
+	}
+	bad := append([]byte(nil), b...)
+	bad[9]++ // c1 length no longer matches the components
+	if err := decoded.UnmarshalBinary(bad); err == nil {
+		t.Fatalf("inconsistent lengths accepted")
+	}
+	small := append([]byte(nil), b...)
+	small[0] = 0 // shrink the domain below the encoded components
+	if err := decoded.UnmarshalBinary(small); err == nil {
+		t.Fatalf("out-of-range component accepted")
+	}
+}
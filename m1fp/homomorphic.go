@@ -37,6 +37,7 @@ func (c *Ciphertext) Add(other *Ciphertext, prec uint16) (*Ciphertext, error) {
 // AddMany performs homomorphic addition of multiple ciphertexts.
 // Efficiently combines multiple encrypted values into a single ciphertext
 // representing their sum, maintaining perfect precision throughout.
+// AddManyContext computes the same sum in parallel.
 func AddMany(prec uint16, cts ...*Ciphertext) (*Ciphertext, error) {
 	if len(cts) == 0 {
 		return nil, fmt.Errorf("no ciphertexts")
@@ -51,3 +52,142 @@ func AddMany(prec uint16, cts ...*Ciphertext) (*Ciphertext, error) {
 	}
 	return acc, nil
 }
+
+// Neg returns an encryption of the additive inverse of the plaintext of c,
+// computed as (-C1 mod D, -C2 mod D). Decrypted with DecryptVoteSigned, the
+// negation of m reads back as -m.
+func (c *Ciphertext) Neg() (*Ciphertext, error) {
+	if c == nil || c.c1 == nil || c.c2 == nil {
+		return nil, fmt.Errorf("nil ciphertext")
+	}
+	if c.d == nil {
+		return nil, fmt.Errorf("missing common denominator")
+	}
+
+	c1 := new(big.Int).Neg(c.c1)
+	c1.Mod(c1, c.d)
+
+	c2 := new(big.Int).Neg(c.c2)
+	c2.Mod(c2, c.d)
+
+	return &Ciphertext{c1: c1, c2: c2, d: new(big.Int).Set(c.d), n: c.n}, nil
+}
+
+// Sub performs homomorphic subtraction in the common domain, so that a ballot
+// can be retracted from a running tally without decrypting either of them.
+// As for Add, the precision parameter is kept for API compatibility.
+func (c *Ciphertext) Sub(other *Ciphertext, prec uint16) (*Ciphertext, error) {
+	neg, err := other.Neg()
+	if err != nil {
+		return nil, err
+	}
+	return c.Add(neg, prec)
+}
+
+// MulScalar multiplies the plaintext of c by k without decrypting, by scaling
+// both components in the common domain: (k · C1 mod D, k · C2 mod D).
+//
+// The decryption noise grows by the same factor k. MulScalar refuses a
+// scalar for which k · 2^RandomnessBits, the randomness of a fresh
+// ciphertext scaled by k, exceeds the noise budget of NoiseBits; scaling a
+// sum of several ciphertexts multiplies their accumulated randomness
+// instead, which the caller must keep within the budget. The scalar must
+// also be below the plaintext capacity 10^n.
+func (c *Ciphertext) MulScalar(k *big.Int) (*Ciphertext, error) {
+	if c == nil || c.c1 == nil || c.c2 == nil {
+		return nil, fmt.Errorf("nil ciphertext")
+	}
+	if c.d == nil {
+		return nil, fmt.Errorf("missing common denominator")
+	}
+	if k == nil || k.Sign() < 0 {
+		return nil, fmt.Errorf("scalar must be non-negative")
+	}
+	if k.Cmp(plaintextCapacity(c.n)) >= 0 {
+		return nil, fmt.Errorf("scalar %s exceeds plaintext capacity of %d digits", k, c.n)
+	}
+	budget, err := c.noiseBudget()
+	if err != nil {
+		return nil, err
+	}
+	if k.BitLen()+RandomnessBits > budget {
+		return nil, fmt.Errorf("scalar %s exceeds the noise budget of %d-digit ciphertexts", k, c.n)
+	}
+
+	c1 := new(big.Int).Mul(c.c1, k)
+	c1.Mod(c1, c.d)
+
+	c2 := new(big.Int).Mul(c.c2, k)
+	c2.Mod(c2, c.d)
+
+	return &Ciphertext{c1: c1, c2: c2, d: new(big.Int).Set(c.d), n: c.n}, nil
+}
+
+// WeightedSum computes Σ weights[i] · Dec(cts[i]) homomorphically, as used for
+// stake-weighted votes. Every ballot is assumed to hold at most MaxVote and
+// fresh randomness below 2^RandomnessBits, and the sum fails if the weighted
+// total could exceed the plaintext capacity 10^n or its randomness the noise
+// budget of NoiseBits.
+func WeightedSum(cts []*Ciphertext, weights []*big.Int) (*Ciphertext, error) {
+	return WeightedSumMax(cts, weights, MaxVote)
+}
+
+// WeightedSumMax is like WeightedSum for ballots whose plaintext is known to be
+// at most maxVote, such as 0/1 entries of multi-candidate ballots.
+func WeightedSumMax(cts []*Ciphertext, weights []*big.Int, maxVote uint64) (*Ciphertext, error) {
+	if len(cts) == 0 {
+		return nil, fmt.Errorf("no ciphertexts")
+	}
+	if len(cts) != len(weights) {
+		return nil, fmt.Errorf("got %d ciphertexts and %d weights", len(cts), len(weights))
+	}
+
+	bound := new(big.Int)
+	noise := new(big.Int) // Σ weights[i], the randomness is below noise · 2^RandomnessBits
+	var acc *Ciphertext
+	for i, ct := range cts {
+		if weights[i] == nil || weights[i].Sign() < 0 {
+			return nil, fmt.Errorf("weight %d must be non-negative", i)
+		}
+		bound.Add(bound, new(big.Int).Mul(weights[i], new(big.Int).SetUint64(maxVote)))
+		noise.Add(noise, weights[i])
+
+		scaled, err := ct.MulScalar(weights[i])
+		if err != nil {
+			return nil, fmt.Errorf("ciphertext %d: %w", i, err)
+		}
+		if acc == nil {
+			acc = scaled
+			continue
+		}
+		if acc, err = acc.Add(scaled, 0); err != nil {
+			return nil, fmt.Errorf("ciphertext %d: %w", i, err)
+		}
+	}
+	if bound.Cmp(plaintextCapacity(acc.n)) >= 0 {
+		return nil, fmt.Errorf("weighted total up to %s overflows plaintext capacity of %d digits", bound, acc.n)
+	}
+	budget, err := acc.noiseBudget()
+	if err != nil {
+		return nil, err
+	}
+	if noise.BitLen()+RandomnessBits > budget {
+		return nil, fmt.Errorf("weights summing to %s exceed the noise budget of %d-digit ciphertexts", noise, acc.n)
+	}
+	return acc, nil
+}
+
+// noiseBudget returns NoiseBits for the digit count of c under the key of
+// its common domain.
+func (c *Ciphertext) noiseBudget() (int, error) {
+	prec, _, ok := domainParameters(c.d)
+	if !ok {
+		return 0, fmt.Errorf("unsupported common denominator")
+	}
+	return noiseBits(c.d, prec, int(c.n)), nil
+}
+
+// plaintextCapacity returns 10^n, the size of the n-digit plaintext space.
+func plaintextCapacity(n uint) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
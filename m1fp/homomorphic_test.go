@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math/big"
 	mrand "math/rand"
+	"strings"
 
 	"testing"
 )
@@ -18,6 +19,38 @@ func INT(s string) *big.Int {
 	return i
 }
 
+func TestEncryptRoundTrip(t *testing.T) {
+	sk, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	// Fresh randomness always fits the noise budget, so every encryption
+	// decrypts, not just those made with small explicit randomness.
+	for i := range 200 {
+		msg := fmt.Sprintf("%03d", i)
+		ct, _, err := Encrypt(pk, msg)
+		if err != nil {
+			t.Fatalf("Encrypt failed: %v", err)
+		}
+		if got, err := Decrypt(sk, ct); err != nil || got != msg {
+			t.Fatalf("Decrypt(Encrypt(%q)) = %q, %v", msg, got, err)
+		}
+
+		vote := uint64(i) * (MaxVote / 200)
+		ct, r, err := EncryptVote(pk, vote, nil)
+		if err != nil {
+			t.Fatalf("EncryptVote failed: %v", err)
+		}
+		if r.BitLen() > RandomnessBits {
+			t.Fatalf("EncryptVote drew %d-bit randomness", r.BitLen())
+		}
+		if got, err := DecryptVote(sk, ct); err != nil || got != vote {
+			t.Fatalf("DecryptVote(EncryptVote(%d)) = %d, %v", vote, got, err)
+		}
+	}
+}
+
 func TestHomomorphicAdditionDebug(t *testing.T) {
 	sk, pk, err := KeyGen(256, X)
 	if err != nil {
@@ -149,6 +182,74 @@ func TestHomomorphicMultipleAdditions(t *testing.T) {
 	t.Logf("Raw sum: %d, Modulo 256: %d, Decrypted: %d", expectedSum, expectedSumMod, actualSum)
 }
 
+func TestHomomorphicSubtraction(t *testing.T) {
+	sk, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	votes := []uint64{12, 64, 0, 33, 5}
+	cts := make([]*Ciphertext, len(votes))
+	var expected int64
+	for i, vote := range votes {
+		if cts[i], _, err = EncryptVote(pk, vote, nil); err != nil {
+			t.Fatalf("EncryptVote failed: %v", err)
+		}
+		expected += int64(vote)
+	}
+	tally, err := AddMany(pk.Prec, cts...)
+	if err != nil {
+		t.Fatalf("AddMany failed: %v", err)
+	}
+
+	// Retract the ballot found ineligible.
+	tally, err = tally.Sub(cts[1], pk.Prec)
+	if err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+	expected -= int64(votes[1])
+
+	// The voter of ballot 3 revotes: old ballot out, new ballot in.
+	revote, _, err := EncryptVote(pk, 40, nil)
+	if err != nil {
+		t.Fatalf("EncryptVote failed: %v", err)
+	}
+	if tally, err = tally.Sub(cts[3], pk.Prec); err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+	if tally, err = tally.Add(revote, pk.Prec); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	expected += 40 - int64(votes[3])
+
+	got, err := DecryptVoteSigned(sk, tally)
+	if err != nil {
+		t.Fatalf("DecryptVoteSigned failed: %v", err)
+	}
+	if got != expected {
+		t.Fatalf("tally after retractions: got %d, want %d", got, expected)
+	}
+	if u, err := DecryptVote(sk, tally); err != nil || int64(u) != expected {
+		t.Fatalf("DecryptVote disagrees on a non-negative tally: got %d (%v), want %d", u, err, expected)
+	}
+
+	// Going below zero reads back as a negative signed value.
+	neg, err := cts[4].Sub(cts[0], pk.Prec)
+	if err != nil {
+		t.Fatalf("Sub failed: %v", err)
+	}
+	if got, err := DecryptVoteSigned(sk, neg); err != nil || got != 5-12 {
+		t.Fatalf("signed difference: got %d (%v), want %d", got, err, 5-12)
+	}
+	zero, err := cts[2].Neg()
+	if err != nil {
+		t.Fatalf("Neg failed: %v", err)
+	}
+	if got, err := DecryptVoteSigned(sk, zero); err != nil || got != 0 {
+		t.Fatalf("negated zero: got %d (%v), want 0", got, err)
+	}
+}
+
 func TestHomomorphicVoting100k(t *testing.T) {
 	const (
 		nVotes    = 100_000
@@ -201,3 +302,65 @@ func TestHomomorphicVoting100k(t *testing.T) {
 		t.Fatalf("tally mismatch: got %d, want %d (difference: %d)", got, expected, int64(got)-int64(expected))
 	}
 }
+
+func TestWeightedSum(t *testing.T) {
+	sk, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	votes := []uint64{1, 0, 1, 1, 0}
+	stakes := []int64{1500, 250000, 42, 1000000, 7}
+	var expected uint64
+
+	cts := make([]*Ciphertext, len(votes))
+	weights := make([]*big.Int, len(votes))
+	for i, vote := range votes {
+		if cts[i], _, err = EncryptVote(pk, vote, nil); err != nil {
+			t.Fatalf("EncryptVote failed: %v", err)
+		}
+		weights[i] = big.NewInt(stakes[i])
+		expected += vote * uint64(stakes[i])
+	}
+
+	sum, err := WeightedSum(cts, weights)
+	if err != nil {
+		t.Fatalf("WeightedSum failed: %v", err)
+	}
+	got, err := DecryptVote(sk, sum)
+	if err != nil {
+		t.Fatalf("DecryptVote failed: %v", err)
+	}
+	if got != expected {
+		t.Fatalf("weighted tally mismatch: got %d, want %d", got, expected)
+	}
+
+	// Stakes whose weighted total could exceed 10^9 are refused.
+	weights[1] = big.NewInt(VoteMod / MaxVote)
+	if _, err := WeightedSum(cts, weights); err == nil {
+		t.Fatalf("overflowing weights accepted")
+	}
+	if _, err := WeightedSumMax(cts, weights, 1); err != nil {
+		t.Fatalf("WeightedSumMax rejected weights that fit 0/1 ballots: %v", err)
+	}
+	if _, err := cts[0].MulScalar(big.NewInt(VoteMod)); err == nil {
+		t.Fatalf("MulScalar accepted a scalar beyond the plaintext capacity")
+	}
+
+	// Scalars that would grow the noise of a fresh ciphertext beyond the
+	// budget are refused even when the plaintext fits.
+	wide, _, err := Encrypt(pk, strings.Repeat("7", 10))
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(pk.NoiseBits(wide.GetDigitCount())-RandomnessBits))
+	if _, err := wide.MulScalar(limit); err == nil {
+		t.Fatalf("MulScalar accepted a scalar beyond the noise budget")
+	}
+	if _, err := wide.MulScalar(new(big.Int).Sub(limit, big.NewInt(1))); err != nil {
+		t.Fatalf("MulScalar rejected a scalar within the noise budget: %v", err)
+	}
+	if _, err := WeightedSumMax([]*Ciphertext{wide, wide}, []*big.Int{big.NewInt(1), new(big.Int).Sub(limit, big.NewInt(1))}, 0); err == nil {
+		t.Fatalf("WeightedSumMax accepted weights beyond the noise budget")
+	}
+}
@@ -0,0 +1,99 @@
+package m1fp
+
+import (
+	"fmt"
+	"io"
+)
+
+// SlotEncoder packs one counter per option into the VoteDigits decimal digits
+// of a single vote ciphertext. Option i occupies the Width digits starting at
+// 10^(i · Width), so a ballot for option i encrypts 10^(i · Width) and a
+// homomorphic sum of ballots holds every option count side by side.
+type SlotEncoder struct {
+	Options int // Number of options packed into the plaintext
+	Width   int // Decimal digits reserved for each option count
+}
+
+// NewSlotEncoder returns an encoder for options choices whose slots are wide
+// enough to count electorate ballots each. It fails if the slots do not fit
+// in the VoteDigits digits of the plaintext, since any slot could then
+// overflow into its neighbour.
+func NewSlotEncoder(options int, electorate uint64) (*SlotEncoder, error) {
+	if options < 1 {
+		return nil, fmt.Errorf("slot encoder needs at least one option")
+	}
+	if electorate < 1 {
+		return nil, fmt.Errorf("electorate must be positive")
+	}
+	width := len(fmt.Sprint(electorate))
+	if options*width > VoteDigits {
+		return nil, fmt.Errorf("%d options of %d digits exceed the %d plaintext digits", options, width, VoteDigits)
+	}
+	return &SlotEncoder{Options: options, Width: width}, nil
+}
+
+// Capacity returns the largest count a single slot can hold.
+func (e *SlotEncoder) Capacity() uint64 {
+	return pow10(e.Width) - 1
+}
+
+// Encode returns the packed plaintext of a ballot choosing option choice.
+func (e *SlotEncoder) Encode(choice int) (uint64, error) {
+	if choice < 0 || choice >= e.Options {
+		return 0, fmt.Errorf("choice %d out of range [0, %d)", choice, e.Options)
+	}
+	return pow10(choice * e.Width), nil
+}
+
+// Decode splits a packed tally, as returned by DecryptVote, into the count
+// of every option.
+func (e *SlotEncoder) Decode(packed uint64) []uint64 {
+	counts := make([]uint64, e.Options)
+	base := pow10(e.Width)
+	for i := range counts {
+		counts[i] = packed % base
+		packed /= base
+	}
+	return counts
+}
+
+// Values lists the plaintexts of every valid packed ballot, in option order.
+func (e *SlotEncoder) Values() []uint64 {
+	vs := make([]uint64, e.Options)
+	for i := range vs {
+		vs[i], _ = e.Encode(i)
+	}
+	return vs
+}
+
+// Encrypt encrypts a packed ballot for choice together with a membership
+// proof that it selects exactly one option. Randomness is read from random.
+func (e *SlotEncoder) Encrypt(pk *PublicKey, choice int, random io.Reader) (*Ciphertext, *RangeProof, error) {
+	v, err := e.Encode(choice)
+	if err != nil {
+		return nil, nil, err
+	}
+	ct, r, err := encryptVoteRandom(pk, v, random)
+	if err != nil {
+		return nil, nil, err
+	}
+	proof, err := ProveMembership(pk, ct, v, r, e.Values(), random)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ct, proof, nil
+}
+
+// Verify checks that ct is a valid packed ballot for this encoder.
+func (e *SlotEncoder) Verify(pk *PublicKey, ct *Ciphertext, proof *RangeProof) error {
+	return VerifyMembership(pk, ct, e.Values(), proof)
+}
+
+// pow10 returns 10^k for the small exponents used by slot packing.
+func pow10(k int) uint64 {
+	p := uint64(1)
+	for range k {
+		p *= 10
+	}
+	return p
+}
@@ -0,0 +1,87 @@
+package m1fp
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+func TestSlotPackingTally(t *testing.T) {
+	sk, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	// Three options for an electorate of up to 999 voters fit in 9 digits.
+	enc, err := NewSlotEncoder(3, 999)
+	if err != nil {
+		t.Fatalf("NewSlotEncoder failed: %v", err)
+	}
+
+	choices := []int{0, 1, 2, 2, 1, 2, 0, 2, 2}
+	want := make([]uint64, 3)
+	cts := make([]*Ciphertext, len(choices))
+	for i, choice := range choices {
+		ct, proof, err := enc.Encrypt(pk, choice, rand.Reader)
+		if err != nil {
+			t.Fatalf("Encrypt failed: %v", err)
+		}
+		if err := enc.Verify(pk, ct, proof); err != nil {
+			t.Fatalf("valid packed ballot rejected: %v", err)
+		}
+		cts[i] = ct
+		want[choice]++
+	}
+
+	sum, err := AddMany(pk.Prec, cts...)
+	if err != nil {
+		t.Fatalf("AddMany failed: %v", err)
+	}
+	packed, err := DecryptVote(sk, sum)
+	if err != nil {
+		t.Fatalf("DecryptVote failed: %v", err)
+	}
+	got := enc.Decode(packed)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("option %d: got %d, want %d (packed %d)", i, got[i], want[i], packed)
+		}
+	}
+}
+
+func TestSlotPackingLimits(t *testing.T) {
+	_, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	if _, err := NewSlotEncoder(4, 999); err == nil {
+		t.Fatalf("4 slots of 3 digits accepted in 9 digits")
+	}
+	enc, err := NewSlotEncoder(9, 9)
+	if err != nil {
+		t.Fatalf("NewSlotEncoder failed: %v", err)
+	}
+	if enc.Capacity() != 9 {
+		t.Fatalf("capacity: got %d, want 9", enc.Capacity())
+	}
+
+	// A ballot stuffing several votes into one slot is rejected.
+	enc3, err := NewSlotEncoder(3, 999)
+	if err != nil {
+		t.Fatalf("NewSlotEncoder failed: %v", err)
+	}
+	ct, r, err := EncryptVote(pk, 5, nil)
+	if err != nil {
+		t.Fatalf("EncryptVote failed: %v", err)
+	}
+	if _, err := ProveMembership(pk, ct, 5, r, enc3.Values(), rand.Reader); err == nil {
+		t.Fatalf("ProveMembership accepted a value outside the set")
+	}
+	_, proof, err := enc3.Encrypt(pk, 0, rand.Reader)
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if err := enc3.Verify(pk, ct, proof); err == nil {
+		t.Fatalf("stuffed packed ballot accepted")
+	}
+}
@@ -0,0 +1,426 @@
+package m1fp
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math/big"
+	mathbits "math/bits"
+	"slices"
+
+	"github.com/p4u/m1fp-go/transcript"
+)
+
+// challengeBits is the number of parallel rounds of the proofs in this
+// package, and so the size of their Fiat–Shamir challenges: bit j of a
+// challenge is the challenge of round j.
+//
+// Challenges are single bits because the plaintexts live in a subgroup of
+// Z_D of smooth order 10^n. Two accepting answers to challenges c ≠ c' only
+// pin down the witness if c - c' is a unit modulo 10^n; a larger challenge
+// space always holds differences divisible by 2 or 5, through which a prover
+// can cheat on the plaintext. With one-bit challenges the difference is ±1,
+// a cheating prover survives each round with probability 1/2 and the proofs
+// are sound up to 2^-challengeBits.
+const challengeBits = 128
+
+// slackBits is the statistical slack of the proof responses. A witness r
+// with |r| < 2^b is answered with an integer in [2^b, 2^(b+slackBits)),
+// which bounds every extracted witness by 2^(b+slackBits) and so keeps the
+// decryption noise of a proven ciphertext within the budget.
+const slackBits = 16
+
+// maxRangeSize bounds the number of branches of a disjunctive range proof,
+// keeping proof size and verification time proportional to sensible ballots.
+const maxRangeSize = 1 << 12
+
+// VoteRange is the closed interval [Min, Max] of plaintext values that a
+// ballot specification accepts for a single encrypted counter.
+type VoteRange struct {
+	Min uint64
+	Max uint64
+}
+
+// DefaultVoteRange matches the bound enforced by EncryptVote.
+var DefaultVoteRange = VoteRange{Min: 0, Max: MaxVote}
+
+// Contains reports whether v lies inside the range.
+func (vr VoteRange) Contains(v uint64) bool {
+	return v >= vr.Min && v <= vr.Max
+}
+
+// values lists every value covered by the range.
+func (vr VoteRange) values() []uint64 {
+	vs := make([]uint64, 0, vr.Max-vr.Min+1)
+	for v := vr.Min; v <= vr.Max; v++ {
+		vs = append(vs, v)
+	}
+	return vs
+}
+
+// validate checks that the range is well formed and representable as a vote.
+func (vr VoteRange) validate() error {
+	if vr.Min > vr.Max {
+		return fmt.Errorf("invalid vote range [%d, %d]", vr.Min, vr.Max)
+	}
+	if vr.Max >= VoteMod {
+		return fmt.Errorf("vote range [%d, %d] exceeds plaintext space", vr.Min, vr.Max)
+	}
+	if vr.Max-vr.Min >= maxRangeSize {
+		return fmt.Errorf("vote range [%d, %d] too wide, max %d values", vr.Min, vr.Max, maxRangeSize)
+	}
+	return nil
+}
+
+// RangeProof is a non-interactive disjunctive (CDS-style) proof that a vote
+// ciphertext encrypts some value of a VoteRange, or of an explicit value set
+// for membership proofs, without revealing which one.
+//
+// For every candidate value v the prover shows knowledge of a small integer
+// r such that (C1, C2 - v · 2^(P-n)) = r · (X, H) mod D, over challengeBits
+// parallel rounds with one-bit challenges. All branches except the real one
+// are simulated, and in every round the branch challenge bits must XOR to
+// the bit of the Fiat–Shamir challenge. Responses are integers, not residues
+// mod D, so the proof also bounds r: ct is then an encryption of v whose
+// decryption noise stays within the budget. Commitments are not stored: the
+// verifier recomputes them from the challenges and responses.
+type RangeProof struct {
+	Challenges []*big.Int   // One challenge per allowed value, a bit per round
+	Responses  [][]*big.Int // One response per allowed value and round
+}
+
+// ProveRange produces a RangeProof showing that ct, created with randomness r,
+// encrypts vote and that vote lies in vr. r must be below 2^RandomnessBits,
+// as drawn by EncryptVoteWithProof. Randomness for the proof is read from
+// random.
+func ProveRange(pk *PublicKey, ct *Ciphertext, vote uint64, r *big.Int, vr VoteRange, random io.Reader) (*RangeProof, error) {
+	return proveRange(pk, ct, vote, r, RandomnessBits, vr, nil, random)
+}
+
+// VerifyRange checks that proof shows ct encrypts a value inside vr.
+// The range must come from the verifier's ballot specification, never from
+// the ballot itself.
+func VerifyRange(pk *PublicKey, ct *Ciphertext, vr VoteRange, proof *RangeProof) error {
+	return verifyRange(pk, ct, RandomnessBits, vr, nil, proof)
+}
+
+// proveRange is ProveRange for randomness r bounded by 2^bits in absolute
+// value, such as the sum of several encryption factors, with the proof
+// bound to context, such as the manifest hash of the election a ballot
+// belongs to.
+func proveRange(pk *PublicKey, ct *Ciphertext, vote uint64, r *big.Int, bits uint, vr VoteRange, context []byte, random io.Reader) (*RangeProof, error) {
+	if err := vr.validate(); err != nil {
+		return nil, err
+	}
+	if !vr.Contains(vote) {
+		return nil, fmt.Errorf("vote %d outside range [%d, %d]", vote, vr.Min, vr.Max)
+	}
+	if err := checkVoteCiphertext(pk, ct); err != nil {
+		return nil, err
+	}
+	return proveDisjunction(rangeTranscript(pk, ct, vr, context), pk, ct, vr.values(), int(vote-vr.Min), r, bits, random)
+}
+
+// verifyRange is VerifyRange for proofs made by proveRange with the same
+// randomness bound and context.
+func verifyRange(pk *PublicKey, ct *Ciphertext, bits uint, vr VoteRange, context []byte, proof *RangeProof) error {
+	if err := vr.validate(); err != nil {
+		return err
+	}
+	if err := checkVoteCiphertext(pk, ct); err != nil {
+		return err
+	}
+	if err := verifyDisjunction(rangeTranscript(pk, ct, vr, context), pk, ct, vr.values(), bits, proof); err != nil {
+		return fmt.Errorf("range proof: %w", err)
+	}
+	return nil
+}
+
+// ProveMembership produces a RangeProof showing that ct, created with
+// randomness r below 2^RandomnessBits, encrypts vote and that vote is one of
+// values. It covers plaintext sets that are not contiguous, such as packed
+// slot ballots.
+func ProveMembership(pk *PublicKey, ct *Ciphertext, vote uint64, r *big.Int, values []uint64, random io.Reader) (*RangeProof, error) {
+	if err := validateValues(values); err != nil {
+		return nil, err
+	}
+	if err := checkVoteCiphertext(pk, ct); err != nil {
+		return nil, err
+	}
+	idx := slices.Index(values, vote)
+	if idx < 0 {
+		return nil, fmt.Errorf("vote %d not in the allowed set", vote)
+	}
+	return proveDisjunction(membershipTranscript(pk, ct, values), pk, ct, values, idx, r, RandomnessBits, random)
+}
+
+// VerifyMembership checks that proof shows ct encrypts one of values.
+func VerifyMembership(pk *PublicKey, ct *Ciphertext, values []uint64, proof *RangeProof) error {
+	if err := validateValues(values); err != nil {
+		return err
+	}
+	if err := checkVoteCiphertext(pk, ct); err != nil {
+		return err
+	}
+	if err := verifyDisjunction(membershipTranscript(pk, ct, values), pk, ct, values, RandomnessBits, proof); err != nil {
+		return fmt.Errorf("membership proof: %w", err)
+	}
+	return nil
+}
+
+// EncryptVoteWithProof encrypts vote like EncryptVote and attaches a
+// RangeProof for vr, so that the tally can reject out-of-range ballots.
+func EncryptVoteWithProof(pk *PublicKey, vote uint64, vr VoteRange, random io.Reader) (*Ciphertext, *big.Int, *RangeProof, error) {
+	if !vr.Contains(vote) {
+		return nil, nil, nil, fmt.Errorf("vote %d outside range [%d, %d]", vote, vr.Min, vr.Max)
+	}
+	ct, r, err := encryptVoteRandom(pk, vote, random)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	proof, err := ProveRange(pk, ct, vote, r, vr, random)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return ct, r, proof, nil
+}
+
+// IngestVote verifies the range proof of an incoming ballot and, if valid,
+// adds it to the running tally. A nil tally starts a new one.
+func IngestVote(pk *PublicKey, tally, ct *Ciphertext, proof *RangeProof, vr VoteRange) (*Ciphertext, error) {
+	if err := VerifyRange(pk, ct, vr, proof); err != nil {
+		return nil, err
+	}
+	if tally == nil {
+		return ct, nil
+	}
+	return tally.Add(ct, pk.Prec)
+}
+
+// proveDisjunction builds the CDS disjunction over values for a statement
+// already absorbed into t. values[realIdx] is the plaintext encrypted with
+// r, and |r| must be below 2^bits.
+func proveDisjunction(t *transcript.Transcript, pk *PublicKey, ct *Ciphertext, values []uint64, realIdx int, r *big.Int, bits uint, random io.Reader) (*RangeProof, error) {
+	if r == nil {
+		return nil, fmt.Errorf("missing encryption randomness")
+	}
+	if uint(r.BitLen()) > bits {
+		return nil, fmt.Errorf("encryption randomness exceeds %d bits", bits)
+	}
+	// A real response outside the accepted interval would leak r, so the
+	// prover starts over with fresh commitments; that happens with
+	// probability below 2^(8-slackBits).
+	for {
+		proof, err := tryDisjunction(t.Clone(), pk, ct, values, realIdx, r, bits, random)
+		if proof != nil || err != nil {
+			return proof, err
+		}
+	}
+}
+
+// tryDisjunction makes one attempt of proveDisjunction. It returns a nil
+// proof without error when a real response falls outside the accepted
+// interval.
+func tryDisjunction(t *transcript.Transcript, pk *PublicKey, ct *Ciphertext, values []uint64, realIdx int, r *big.Int, bits uint, random io.Reader) (*RangeProof, error) {
+	lo, hi := responseBounds(bits)
+	span := new(big.Int).Sub(hi, lo)
+	k := len(values)
+	proof := &RangeProof{
+		Challenges: make([]*big.Int, k),
+		Responses:  make([][]*big.Int, k),
+	}
+	commits := make([][][2]*big.Int, k)
+
+	// The real commitments are drawn from [0, 2^(bits+slackBits) + 2^bits),
+	// so that z = w + c · r is uniform on [lo, hi) whatever c and r are.
+	wMax := new(big.Int).Add(hi, lo)
+	ws := make([]*big.Int, challengeBits)
+	for i := range k {
+		if i == realIdx {
+			commits[i] = make([][2]*big.Int, challengeBits)
+			for j := range ws {
+				w, err := rand.Int(random, wMax)
+				if err != nil {
+					return nil, err
+				}
+				ws[j] = w
+				commits[i][j] = [2]*big.Int{mulMod(w, pk.XInt, pk.D), mulMod(w, pk.HInt, pk.D)}
+			}
+			continue
+		}
+		c, err := rand.Int(random, challengeModulus())
+		if err != nil {
+			return nil, err
+		}
+		zs := make([]*big.Int, challengeBits)
+		for j := range zs {
+			if zs[j], err = rand.Int(random, span); err != nil {
+				return nil, err
+			}
+			zs[j].Add(zs[j], lo)
+		}
+		proof.Challenges[i], proof.Responses[i] = c, zs
+		commits[i] = branchCommitments(pk, ct, values[i], c, zs)
+	}
+
+	c := disjunctionChallenge(t, commits)
+	for i := range k {
+		if i != realIdx {
+			c.Xor(c, proof.Challenges[i])
+		}
+	}
+	zs := make([]*big.Int, challengeBits)
+	for j, w := range ws {
+		z := new(big.Int).Set(w)
+		if c.Bit(j) == 1 {
+			z.Add(z, r)
+		}
+		if z.Cmp(lo) < 0 || z.Cmp(hi) >= 0 {
+			return nil, nil
+		}
+		zs[j] = z
+	}
+	proof.Challenges[realIdx], proof.Responses[realIdx] = c, zs
+	return proof, nil
+}
+
+// verifyDisjunction checks a CDS disjunction over values, for randomness
+// bounded by 2^bits, for a statement already absorbed into t.
+func verifyDisjunction(t *transcript.Transcript, pk *PublicKey, ct *Ciphertext, values []uint64, bits uint, proof *RangeProof) error {
+	k := len(values)
+	if proof == nil || len(proof.Challenges) != k || len(proof.Responses) != k {
+		return fmt.Errorf("malformed proof")
+	}
+
+	lo, hi := responseBounds(bits)
+	cMod := challengeModulus()
+	xor := new(big.Int)
+	commits := make([][][2]*big.Int, k)
+	for i := range k {
+		c, zs := proof.Challenges[i], proof.Responses[i]
+		if c == nil || c.Sign() < 0 || c.Cmp(cMod) >= 0 || len(zs) != challengeBits {
+			return fmt.Errorf("malformed proof")
+		}
+		for _, z := range zs {
+			if z == nil || z.Cmp(lo) < 0 || z.Cmp(hi) >= 0 {
+				return fmt.Errorf("proof value out of bounds")
+			}
+		}
+		commits[i] = branchCommitments(pk, ct, values[i], c, zs)
+		xor.Xor(xor, c)
+	}
+
+	if xor.Cmp(disjunctionChallenge(t, commits)) != 0 {
+		return fmt.Errorf("challenge mismatch")
+	}
+	return nil
+}
+
+// branchCommitments recomputes the commitments of the branch for value v,
+// one per round: A_j = z_j · (X, H) - c_j · (C1, C2 - v · 2^(P-n)) mod D,
+// where c_j is bit j of c.
+func branchCommitments(pk *PublicKey, ct *Ciphertext, v uint64, c *big.Int, zs []*big.Int) [][2]*big.Int {
+	y2 := new(big.Int).Mul(new(big.Int).SetUint64(v), voteScale(pk))
+	y2.Sub(ct.c2, y2)
+
+	commits := make([][2]*big.Int, len(zs))
+	for j, z := range zs {
+		a1, a2 := mulMod(z, pk.XInt, pk.D), mulMod(z, pk.HInt, pk.D)
+		if c.Bit(j) == 1 {
+			a1.Sub(a1, ct.c1).Mod(a1, pk.D)
+			a2.Sub(a2, y2).Mod(a2, pk.D)
+		}
+		commits[j] = [2]*big.Int{a1, a2}
+	}
+	return commits
+}
+
+// disjunctionChallenge absorbs the branch commitments into t and derives
+// the Fiat–Shamir challenge.
+func disjunctionChallenge(t *transcript.Transcript, commits [][][2]*big.Int) *big.Int {
+	for _, branch := range commits {
+		for _, a := range branch {
+			t.AppendBigInt("commit-c1", a[0])
+			t.AppendBigInt("commit-c2", a[1])
+		}
+	}
+	return t.ChallengeBits("challenge", challengeBits)
+}
+
+// responseBounds returns the interval [lo, hi) = [2^bits, 2^(bits+slackBits))
+// of the responses for randomness bounded by 2^bits.
+func responseBounds(bits uint) (lo, hi *big.Int) {
+	return new(big.Int).Lsh(big.NewInt(1), bits), new(big.Int).Lsh(big.NewInt(1), bits+slackBits)
+}
+
+// sumBits bounds the randomness of a sum of n ciphertexts from
+// encryptVoteRandom: it is below n · 2^RandomnessBits.
+func sumBits(n int) uint {
+	return RandomnessBits + uint(mathbits.Len(uint(n)))
+}
+
+// rangeTranscript starts the transcript of a range proof statement.
+func rangeTranscript(pk *PublicKey, ct *Ciphertext, vr VoteRange, context []byte) *transcript.Transcript {
+	t := newTranscript("m1fp/range-proof", pk)
+	t.AppendMessage("context", context)
+	t.AppendCiphertext("ciphertext", ct)
+	t.AppendUint64("min", vr.Min)
+	t.AppendUint64("max", vr.Max)
+	return t
+}
+
+// membershipTranscript starts the transcript of a membership proof statement.
+func membershipTranscript(pk *PublicKey, ct *Ciphertext, values []uint64) *transcript.Transcript {
+	t := newTranscript("m1fp/membership-proof", pk)
+	t.AppendCiphertext("ciphertext", ct)
+	t.AppendUint64("size", uint64(len(values)))
+	for _, v := range values {
+		t.AppendUint64("value", v)
+	}
+	return t
+}
+
+// validateValues checks an explicit set of allowed plaintexts.
+func validateValues(values []uint64) error {
+	if len(values) == 0 || len(values) > maxRangeSize {
+		return fmt.Errorf("allowed set must have between 1 and %d values", maxRangeSize)
+	}
+	for i, v := range values {
+		if v >= VoteMod {
+			return fmt.Errorf("allowed value %d exceeds plaintext space", v)
+		}
+		if slices.Contains(values[:i], v) {
+			return fmt.Errorf("duplicate allowed value %d", v)
+		}
+	}
+	return nil
+}
+
+// checkVoteCiphertext ensures a ciphertext was produced for pk by the vote
+// encoding, which is the only layout the proofs understand.
+func checkVoteCiphertext(pk *PublicKey, ct *Ciphertext) error {
+	if pk == nil || pk.D == nil || pk.XInt == nil || pk.HInt == nil {
+		return fmt.Errorf("invalid public key")
+	}
+	if ct == nil || ct.c1 == nil || ct.c2 == nil || ct.d == nil {
+		return fmt.Errorf("nil ciphertext")
+	}
+	if ct.d.Cmp(pk.D) != 0 {
+		return fmt.Errorf("mismatched common denominators")
+	}
+	if ct.n != VoteDigits {
+		return fmt.Errorf("ciphertext is not a vote: %d digits, want %d", ct.n, VoteDigits)
+	}
+	return nil
+}
+
+// challengeModulus returns 2^challengeBits.
+func challengeModulus() *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), challengeBits)
+}
+
+// mulMod returns (a · b) mod m as a new integer.
+func mulMod(a, b, m *big.Int) *big.Int {
+	r := new(big.Int).Mul(a, b)
+	return r.Mod(r, m)
+}
@@ -0,0 +1,258 @@
+package m1fp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/p4u/m1fp-go/transcript"
+)
+
+func TestRangeProofValidVotes(t *testing.T) {
+	_, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	for _, vote := range []uint64{0, 1, 32, MaxVote} {
+		ct, _, proof, err := EncryptVoteWithProof(pk, vote, DefaultVoteRange, rand.Reader)
+		if err != nil {
+			t.Fatalf("EncryptVoteWithProof(%d) failed: %v", vote, err)
+		}
+		if err := VerifyRange(pk, ct, DefaultVoteRange, proof); err != nil {
+			t.Fatalf("valid proof for vote %d rejected: %v", vote, err)
+		}
+
+		// Proofs travel as JSON, with their integers as decimal strings.
+		data, err := json.Marshal(proof)
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		if !bytes.HasPrefix(data, []byte(`{"Challenges":["`)) {
+			t.Fatalf("proof integers not encoded as strings: %.60s", data)
+		}
+		decoded := new(RangeProof)
+		if err := json.Unmarshal(data, decoded); err != nil {
+			t.Fatalf("Unmarshal failed: %v", err)
+		}
+		if err := VerifyRange(pk, ct, DefaultVoteRange, decoded); err != nil {
+			t.Fatalf("decoded proof for vote %d rejected: %v", vote, err)
+		}
+	}
+}
+
+func TestRangeProofRejectsOversizedVote(t *testing.T) {
+	_, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	// A malicious voter encrypts 10^6 directly and tries to prove it in range.
+	r := big.NewInt(4242)
+	ct, _, err := encryptDigits(pk, fmt.Sprintf("%0*d", VoteDigits, 1000000), r)
+	if err != nil {
+		t.Fatalf("encryptDigits failed: %v", err)
+	}
+	if _, err := ProveRange(pk, ct, 1000000, r, DefaultVoteRange, rand.Reader); err == nil {
+		t.Fatalf("ProveRange accepted an out-of-range vote")
+	}
+
+	// Reusing a proof produced for another ciphertext must fail as well.
+	_, _, proof, err := EncryptVoteWithProof(pk, 3, DefaultVoteRange, rand.Reader)
+	if err != nil {
+		t.Fatalf("EncryptVoteWithProof failed: %v", err)
+	}
+	if err := VerifyRange(pk, ct, DefaultVoteRange, proof); err == nil {
+		t.Fatalf("proof transplanted onto Enc(10^6) was accepted")
+	}
+	if _, err := IngestVote(pk, nil, ct, proof, DefaultVoteRange); err == nil {
+		t.Fatalf("IngestVote accepted Enc(10^6)")
+	}
+}
+
+func TestRangeProofTamperingAndRange(t *testing.T) {
+	sk, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	vr := VoteRange{Min: 0, Max: 10}
+	ct, _, err := EncryptVote(pk, 7, big.NewInt(99))
+	if err != nil {
+		t.Fatalf("EncryptVote failed: %v", err)
+	}
+	proof, err := ProveRange(pk, ct, 7, big.NewInt(99), vr, rand.Reader)
+	if err != nil {
+		t.Fatalf("ProveRange failed: %v", err)
+	}
+
+	// The verifier's range, not the prover's, decides what is accepted.
+	if err := VerifyRange(pk, ct, VoteRange{Min: 0, Max: 5}, proof); err == nil {
+		t.Fatalf("proof accepted under a different range")
+	}
+
+	proof.Responses[3][5] = new(big.Int).Add(proof.Responses[3][5], big.NewInt(1))
+	if err := VerifyRange(pk, ct, vr, proof); err == nil {
+		t.Fatalf("tampered proof accepted")
+	}
+
+	// Ingestion of valid ballots still tallies exactly.
+	var tally *Ciphertext
+	for i, vote := range []uint64{4, 10, 0, 9} {
+		r := big.NewInt(int64(1000 + i))
+		ct, _, err := EncryptVote(pk, vote, r)
+		if err != nil {
+			t.Fatalf("EncryptVote failed: %v", err)
+		}
+		proof, err := ProveRange(pk, ct, vote, r, vr, rand.Reader)
+		if err != nil {
+			t.Fatalf("ProveRange failed: %v", err)
+		}
+		if tally, err = IngestVote(pk, tally, ct, proof, vr); err != nil {
+			t.Fatalf("IngestVote failed: %v", err)
+		}
+	}
+	got, err := DecryptVote(sk, tally)
+	if err != nil {
+		t.Fatalf("DecryptVote failed: %v", err)
+	}
+	if got != 23 {
+		t.Fatalf("tally mismatch: got %d, want 23", got)
+	}
+}
+
+// forgeDisjunction plays a cheating prover for the statement absorbed into
+// t. It answers honestly with randomness r for the branch values[target],
+// whose statement is off by offset in C2, and grinds the Fiat–Shamir
+// challenge by guessing the challenge bit of every round in advance.
+func forgeDisjunction(t *transcript.Transcript, pk *PublicKey, ct *Ciphertext, values []uint64, target int, offset, r *big.Int, bits uint) (*RangeProof, error) {
+	lo, hi := responseBounds(bits)
+	span := new(big.Int).Sub(hi, lo)
+
+	guess, err := rand.Int(rand.Reader, challengeModulus())
+	if err != nil {
+		return nil, err
+	}
+	proof := &RangeProof{Challenges: make([]*big.Int, len(values)), Responses: make([][]*big.Int, len(values))}
+	commits := make([][][2]*big.Int, len(values))
+	ws := make([]*big.Int, challengeBits)
+	for i := range values {
+		if i == target {
+			commits[i] = make([][2]*big.Int, challengeBits)
+			for j := range ws {
+				ws[j], _ = rand.Int(rand.Reader, lo)
+				ws[j].Add(ws[j], lo)
+				a2 := mulMod(ws[j], pk.HInt, pk.D)
+				if guess.Bit(j) == 1 {
+					a2.Sub(a2, offset).Mod(a2, pk.D)
+				}
+				commits[i][j] = [2]*big.Int{mulMod(ws[j], pk.XInt, pk.D), a2}
+			}
+			continue
+		}
+		c, _ := rand.Int(rand.Reader, challengeModulus())
+		zs := make([]*big.Int, challengeBits)
+		for j := range zs {
+			zs[j], _ = rand.Int(rand.Reader, span)
+			zs[j].Add(zs[j], lo)
+		}
+		proof.Challenges[i], proof.Responses[i] = c, zs
+		commits[i] = branchCommitments(pk, ct, values[i], c, zs)
+	}
+
+	c := disjunctionChallenge(t, commits)
+	for i := range values {
+		if i != target {
+			c.Xor(c, proof.Challenges[i])
+		}
+	}
+	zs := make([]*big.Int, challengeBits)
+	for j, w := range ws {
+		zs[j] = new(big.Int).Set(w)
+		if c.Bit(j) == 1 {
+			zs[j].Add(zs[j], r)
+		}
+	}
+	proof.Challenges[target], proof.Responses[target] = c, zs
+	return proof, nil
+}
+
+// forgeRange runs forgeDisjunction to pass Enc(m) with randomness r off as
+// a vote for v in vr.
+func forgeRange(pk *PublicKey, ct *Ciphertext, m, v uint64, r *big.Int, vr VoteRange) (*RangeProof, error) {
+	offset := new(big.Int).Mul(new(big.Int).SetUint64(m-v), voteScale(pk))
+	return forgeDisjunction(rangeTranscript(pk, ct, vr, nil), pk, ct, vr.values(), int(v-vr.Min), offset, r, RandomnessBits)
+}
+
+func TestRangeProofRejectsGrindingProver(t *testing.T) {
+	_, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	// 100000003 - 3 = 10^8 is divisible by almost the whole plaintext order,
+	// which made the challenges of the former proof easy to grind.
+	const m = 100000003
+	r := big.NewInt(4242)
+	ct, _, err := encryptDigits(pk, fmt.Sprintf("%0*d", VoteDigits, m), r)
+	if err != nil {
+		t.Fatalf("encryptDigits failed: %v", err)
+	}
+	vr := VoteRange{Min: 0, Max: 7}
+	for attempt := range 256 {
+		proof, err := forgeRange(pk, ct, m, 3, r, vr)
+		if err != nil {
+			t.Fatalf("forgeRange failed: %v", err)
+		}
+		if err := VerifyRange(pk, ct, vr, proof); err == nil {
+			t.Fatalf("forged proof for Enc(%d) accepted after %d attempts", m, attempt+1)
+		}
+	}
+
+	// The forger's answers are right whenever it guessed a bit correctly:
+	// a forgery for a ciphertext that really encrypts 3 passes.
+	honest, _, err := EncryptVote(pk, 3, r)
+	if err != nil {
+		t.Fatalf("EncryptVote failed: %v", err)
+	}
+	proof, err := forgeRange(pk, honest, 3, 3, r, vr)
+	if err != nil {
+		t.Fatalf("forgeRange failed: %v", err)
+	}
+	if err := VerifyRange(pk, honest, vr, proof); err != nil {
+		t.Fatalf("forger's proof for an honest ciphertext rejected: %v", err)
+	}
+}
+
+func TestRangeProofBoundsRandomness(t *testing.T) {
+	_, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	// r + D / gcd(X, D) opens the same ciphertext, but its decryption noise
+	// is far beyond the budget; the proof must not accept such witnesses.
+	r := big.NewInt(77)
+	ct, _, err := EncryptVote(pk, 5, r)
+	if err != nil {
+		t.Fatalf("EncryptVote failed: %v", err)
+	}
+	wide := new(big.Int).Div(pk.D, new(big.Int).GCD(nil, nil, pk.XInt, pk.D))
+	wide.Add(wide, r)
+	if mulMod(wide, pk.XInt, pk.D).Cmp(ct.c1) != 0 {
+		t.Fatalf("test witness does not open C1")
+	}
+	if _, err := ProveRange(pk, ct, 5, wide, DefaultVoteRange, rand.Reader); err == nil {
+		t.Fatalf("ProveRange accepted randomness above 2^%d", RandomnessBits)
+	}
+	proof, err := proveRange(pk, ct, 5, wide, uint(wide.BitLen()), DefaultVoteRange, nil, rand.Reader)
+	if err != nil {
+		t.Fatalf("proveRange failed: %v", err)
+	}
+	if err := VerifyRange(pk, ct, DefaultVoteRange, proof); err == nil {
+		t.Fatalf("proof with a %d-bit witness accepted", wide.BitLen())
+	}
+}
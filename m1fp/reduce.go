@@ -0,0 +1,127 @@
+package m1fp
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// reduceChunk is the number of ciphertexts a worker of AddManyContext sums
+// between two cancellation checks and progress reports.
+const reduceChunk = 4096
+
+// AddManyContext computes the same sum as AddMany with a parallel tree
+// reduction: workers goroutines (GOMAXPROCS if workers <= 0) each sum
+// chunks of cts in place, and their partial sums are then added. It stops
+// with the context error once ctx is done, checking between chunks.
+func AddManyContext(ctx context.Context, cts []*Ciphertext, workers int) (*Ciphertext, error) {
+	return AddManyProgress(ctx, cts, workers, nil)
+}
+
+// AddManyProgress is AddManyContext calling progress, if not nil, after
+// every chunk with the number of ciphertexts added so far and the total.
+// Calls are serialized and done never decreases.
+func AddManyProgress(ctx context.Context, cts []*Ciphertext, workers int, progress func(done, total int)) (*Ciphertext, error) {
+	if len(cts) == 0 {
+		return nil, fmt.Errorf("no ciphertexts")
+	}
+	if cts[0] == nil || cts[0].d == nil {
+		return nil, fmt.Errorf("ciphertext 0: nil ciphertext")
+	}
+	d := cts[0].d
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	chunks := (len(cts) + reduceChunk - 1) / reduceChunk
+	workers = min(workers, chunks)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		next     atomic.Int64
+		mu       sync.Mutex // Guards done, firstErr and progress calls
+		done     int
+		firstErr error
+	)
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+		cancel()
+	}
+
+	partials := make([]*Ciphertext, workers)
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			acc := &Ciphertext{c1: new(big.Int), c2: new(big.Int), d: new(big.Int).Set(d)}
+			for {
+				if err := ctx.Err(); err != nil {
+					fail(err)
+					return
+				}
+				c := int(next.Add(1)) - 1
+				if c >= chunks {
+					break
+				}
+				lo := c * reduceChunk
+				hi := min(lo+reduceChunk, len(cts))
+				if err := acc.addChunk(cts[lo:hi], lo); err != nil {
+					fail(err)
+					return
+				}
+				if progress != nil {
+					mu.Lock()
+					done += hi - lo
+					progress(done, len(cts))
+					mu.Unlock()
+				}
+			}
+			partials[w] = acc
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	// Add the partial sums pairwise, halving their number at every level.
+	for len(partials) > 1 {
+		half := (len(partials) + 1) / 2
+		for i := range len(partials) / 2 {
+			sum, err := partials[i].Add(partials[half+i], 0)
+			if err != nil {
+				return nil, err
+			}
+			partials[i] = sum
+		}
+		partials = partials[:half]
+	}
+	return partials[0], nil
+}
+
+// addChunk adds cts, the ciphertexts from index first on, to c in place,
+// reducing modulo D once at the end.
+func (c *Ciphertext) addChunk(cts []*Ciphertext, first int) error {
+	for i, ct := range cts {
+		if ct == nil || ct.c1 == nil || ct.c2 == nil || ct.d == nil {
+			return fmt.Errorf("ciphertext %d: nil ciphertext", first+i)
+		}
+		if ct.d.Cmp(c.d) != 0 {
+			return fmt.Errorf("ciphertext %d: mismatched common denominators", first+i)
+		}
+		c.c1.Add(c.c1, ct.c1)
+		c.c2.Add(c.c2, ct.c2)
+		c.n = max(c.n, ct.n)
+	}
+	c.c1.Mod(c.c1, c.d)
+	c.c2.Mod(c.c2, c.d)
+	return nil
+}
@@ -0,0 +1,60 @@
+package m1fp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestAddManyContext(t *testing.T) {
+	sk, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	const n = 3*reduceChunk + 17
+	cts := make([]*Ciphertext, n)
+	var want uint64
+	for i := range cts {
+		v := uint64(i % 3)
+		if cts[i], _, err = EncryptVote(pk, v, big.NewInt(int64(i+1))); err != nil {
+			t.Fatalf("EncryptVote failed: %v", err)
+		}
+		want += v
+	}
+	seq, err := AddMany(pk.Prec, cts...)
+	if err != nil {
+		t.Fatalf("AddMany failed: %v", err)
+	}
+	seqBytes, _ := seq.MarshalBinary()
+
+	for _, workers := range []int{0, 1, 3, 16} {
+		last := 0
+		sum, err := AddManyProgress(context.Background(), cts, workers, func(done, total int) {
+			if done <= last || total != n {
+				t.Errorf("progress %d/%d after %d", done, total, last)
+			}
+			last = done
+		})
+		if err != nil {
+			t.Fatalf("AddManyProgress with %d workers failed: %v", workers, err)
+		}
+		if last != n {
+			t.Fatalf("progress ended at %d of %d", last, n)
+		}
+		if b, _ := sum.MarshalBinary(); !bytes.Equal(b, seqBytes) {
+			t.Fatalf("parallel sum with %d workers differs from AddMany", workers)
+		}
+	}
+	if got, _ := DecryptVote(sk, seq); got != want {
+		t.Fatalf("sum decrypts to %d, want %d", got, want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := AddManyContext(ctx, cts, 2); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled reduction returned %v", err)
+	}
+}
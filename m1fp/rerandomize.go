@@ -0,0 +1,55 @@
+package m1fp
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// ReRandomize refreshes ct without knowing its plaintext by adding a fresh
+// encryption of zero in the common domain. The result decrypts to the same
+// message with fresh components. It does not make ct unlinkable: anyone can
+// recover the randomness of both ciphertexts from C1 (see the README
+// limitations), and with it the factor that relates them.
+func ReRandomize(pk *PublicKey, ct *Ciphertext, random io.Reader) (*Ciphertext, error) {
+	out, _, err := ReRandomizeWithFactor(pk, ct, random)
+	return out, err
+}
+
+// ReRandomizeWithFactor is like ReRandomize but also returns the factor s used,
+// so that (C1 + s · X, C2 + s · H) mod D can be proven in zero knowledge.
+// If ct was created with randomness r, the result opens with r + s.
+func ReRandomizeWithFactor(pk *PublicKey, ct *Ciphertext, random io.Reader) (*Ciphertext, *big.Int, error) {
+	s, err := randomFactor(random)
+	if err != nil {
+		return nil, nil, err
+	}
+	out, err := ReRandomizeDeterministic(pk, ct, s)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, s, nil
+}
+
+// ReRandomizeDeterministic adds the encryption of zero with randomness s to ct.
+func ReRandomizeDeterministic(pk *PublicKey, ct *Ciphertext, s *big.Int) (*Ciphertext, error) {
+	if err := pk.CheckDomain(ct); err != nil {
+		return nil, err
+	}
+	if pk.XInt == nil || pk.HInt == nil {
+		return nil, fmt.Errorf("invalid public key")
+	}
+	if s == nil {
+		return nil, fmt.Errorf("missing re-randomization factor")
+	}
+
+	c1 := new(big.Int).Mul(s, pk.XInt)
+	c1.Add(c1, ct.c1)
+	c1.Mod(c1, pk.D)
+
+	c2 := new(big.Int).Mul(s, pk.HInt)
+	c2.Add(c2, ct.c2)
+	c2.Mod(c2, pk.D)
+
+	return &Ciphertext{c1: c1, c2: c2, d: new(big.Int).Set(pk.D), n: ct.n}, nil
+}
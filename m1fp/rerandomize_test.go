@@ -0,0 +1,76 @@
+package m1fp
+
+import (
+	"crypto/rand"
+	"math/big"
+	"testing"
+)
+
+func TestReRandomizePreservesVote(t *testing.T) {
+	sk, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	for _, vote := range []uint64{0, 1, 42, MaxVote} {
+		ct, r, err := EncryptVote(pk, vote, nil)
+		if err != nil {
+			t.Fatalf("EncryptVote failed: %v", err)
+		}
+
+		fresh, s, err := ReRandomizeWithFactor(pk, ct, rand.Reader)
+		if err != nil {
+			t.Fatalf("ReRandomizeWithFactor failed: %v", err)
+		}
+		if fresh.GetC1Int().Cmp(ct.GetC1Int()) == 0 || fresh.GetC2Int().Cmp(ct.GetC2Int()) == 0 {
+			t.Fatalf("re-randomized ciphertext shares a component with the original")
+		}
+
+		got, err := DecryptVote(sk, fresh)
+		if err != nil {
+			t.Fatalf("DecryptVote failed: %v", err)
+		}
+		if got != vote {
+			t.Fatalf("vote changed by re-randomization: got %d, want %d", got, vote)
+		}
+
+		// The returned factor composes with the original randomness.
+		if err := VerifyOpening(pk, fresh, vote, new(big.Int).Add(r, s)); err != nil {
+			t.Fatalf("re-randomized ciphertext does not open with r + s: %v", err)
+		}
+	}
+}
+
+func TestRepeatedReRandomizationKeepsVote(t *testing.T) {
+	sk, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	ct, _, err := EncryptVote(pk, 7, nil)
+	if err != nil {
+		t.Fatalf("EncryptVote failed: %v", err)
+	}
+
+	// Repeated refreshes never repeat a component and keep decrypting to 7.
+	seen := map[string]bool{ct.GetC1Int().String(): true, ct.GetC2Int().String(): true}
+	cur := ct
+	for range 50 {
+		if cur, err = ReRandomize(pk, cur, rand.Reader); err != nil {
+			t.Fatalf("ReRandomize failed: %v", err)
+		}
+		for _, c := range []*big.Int{cur.GetC1Int(), cur.GetC2Int()} {
+			if seen[c.String()] {
+				t.Fatalf("component repeated after re-randomization")
+			}
+			seen[c.String()] = true
+		}
+	}
+	got, err := DecryptVote(sk, cur)
+	if err != nil {
+		t.Fatalf("DecryptVote failed: %v", err)
+	}
+	if got != 7 {
+		t.Fatalf("vote changed after 50 re-randomizations: got %d, want 7", got)
+	}
+}
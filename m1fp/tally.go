@@ -0,0 +1,98 @@
+package m1fp
+
+import (
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Tally is a running sum of vote ciphertexts that is safe for concurrent
+// use, e.g. from many HTTP handlers accepting ballots at once.
+//
+// Add folds a ciphertext into one of several shards, each a partial sum
+// behind its own lock, updated in place without allocating a new
+// ciphertext. Snapshot merges the shards into the sum of everything added
+// so far, which decrypts with DecryptVote like the result of AddMany.
+type Tally struct {
+	pk     *PublicKey
+	shards []tallyShard
+	next   atomic.Uint64 // Shard the next Add starts probing from
+}
+
+// tallyShard is one partial sum of a Tally.
+type tallyShard struct {
+	mu      sync.Mutex
+	c1, c2  big.Int
+	ballots uint64
+	_       [64]byte // Keep shards on separate cache lines
+}
+
+// NewTally returns an empty tally of vote ciphertexts under pk, with one
+// shard per CPU usable by the process.
+func NewTally(pk *PublicKey) *Tally {
+	return &Tally{pk: pk, shards: make([]tallyShard, runtime.GOMAXPROCS(0))}
+}
+
+// Add adds one vote ciphertext to the tally.
+func (t *Tally) Add(ct *Ciphertext) error {
+	if err := checkVoteCiphertext(t.pk, ct); err != nil {
+		return err
+	}
+
+	s := t.lockShard()
+	s.c1.Add(&s.c1, ct.c1).Mod(&s.c1, t.pk.D)
+	s.c2.Add(&s.c2, ct.c2).Mod(&s.c2, t.pk.D)
+	s.ballots++
+	s.mu.Unlock()
+	return nil
+}
+
+// lockShard locks and returns the first free shard from a rotating start,
+// so concurrent callers spread over the shards instead of queueing on one
+// lock. If all are busy it waits for the starting one.
+func (t *Tally) lockShard() *tallyShard {
+	start := int(t.next.Add(1) % uint64(len(t.shards)))
+	for i := range t.shards {
+		if s := &t.shards[(start+i)%len(t.shards)]; s.mu.TryLock() {
+			return s
+		}
+	}
+	s := &t.shards[start]
+	s.mu.Lock()
+	return s
+}
+
+// Snapshot returns the sum of every ciphertext added so far and their
+// number. The shards are locked together, so the sum and the count are
+// consistent with each other even while other goroutines keep adding. An
+// empty tally yields the trivial encryption (0, 0) of zero.
+func (t *Tally) Snapshot() (*Ciphertext, uint64) {
+	for i := range t.shards {
+		t.shards[i].mu.Lock()
+	}
+	c1, c2 := new(big.Int), new(big.Int)
+	var ballots uint64
+	for i := range t.shards {
+		s := &t.shards[i]
+		c1.Add(c1, &s.c1)
+		c2.Add(c2, &s.c2)
+		ballots += s.ballots
+		s.mu.Unlock()
+	}
+	c1.Mod(c1, t.pk.D)
+	c2.Mod(c2, t.pk.D)
+	return &Ciphertext{c1: c1, c2: c2, d: new(big.Int).Set(t.pk.D), n: VoteDigits}, ballots
+}
+
+// Ballots returns the number of ciphertexts added so far.
+func (t *Tally) Ballots() uint64 {
+	var ballots uint64
+	for i := range t.shards {
+		s := &t.shards[i]
+		s.mu.Lock()
+		ballots += s.ballots
+		s.mu.Unlock()
+	}
+	return ballots
+}
@@ -0,0 +1,75 @@
+package m1fp
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestTallyConcurrentAdd(t *testing.T) {
+	sk, pk, err := KeyGen(256, X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	const voters = 400
+	cts := make([]*Ciphertext, voters)
+	var want uint64
+	for i := range cts {
+		v := uint64(i % (MaxVote + 1))
+		if cts[i], _, err = EncryptVote(pk, v, nil); err != nil {
+			t.Fatalf("EncryptVote failed: %v", err)
+		}
+		want += v
+	}
+
+	tally := NewTally(pk)
+	if ct, n := tally.Snapshot(); n != 0 {
+		t.Fatalf("empty tally counts %d ballots", n)
+	} else if v, _ := DecryptVote(sk, ct); v != 0 {
+		t.Fatalf("empty tally decrypts to %d", v)
+	}
+
+	var wg sync.WaitGroup
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := w; i < voters; i += 8 {
+				if err := tally.Add(cts[i]); err != nil {
+					t.Errorf("Add failed: %v", err)
+				}
+			}
+		}()
+	}
+	// Snapshots taken while adding must be consistent.
+	for range 20 {
+		if ct, n := tally.Snapshot(); n > 0 {
+			if _, err := DecryptVote(sk, ct); err != nil {
+				t.Fatalf("DecryptVote of a partial snapshot failed: %v", err)
+			}
+		}
+	}
+	wg.Wait()
+
+	ct, n := tally.Snapshot()
+	if n != voters || tally.Ballots() != voters {
+		t.Fatalf("tally counts %d ballots, want %d", n, voters)
+	}
+	got, err := DecryptVote(sk, ct)
+	if err != nil {
+		t.Fatalf("DecryptVote failed: %v", err)
+	}
+	if got != want {
+		t.Fatalf("tally decrypts to %d, want %d", got, want)
+	}
+	sum, err := AddMany(pk.Prec, cts...)
+	if err != nil {
+		t.Fatalf("AddMany failed: %v", err)
+	}
+	a, _ := ct.MarshalBinary()
+	b, _ := sum.MarshalBinary()
+	if !bytes.Equal(a, b) {
+		t.Fatalf("tally differs from AddMany")
+	}
+}
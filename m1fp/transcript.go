@@ -0,0 +1,11 @@
+package m1fp
+
+import "github.com/p4u/m1fp-go/transcript"
+
+// newTranscript starts a Fiat–Shamir transcript for the proof identified by
+// domain and binds it to the public key the proof is made under.
+func newTranscript(domain string, pk *PublicKey) *transcript.Transcript {
+	t := transcript.New(domain)
+	t.AppendPublicKey("pk", pk.Prec, pk.N, pk.XInt, pk.HInt)
+	return t
+}
@@ -3,6 +3,7 @@ package m1fp
 import (
 	"crypto/rand"
 	"fmt"
+	"io"
 	"math/big"
 )
 
@@ -11,13 +12,14 @@ import (
 const (
 	VoteDigits = 9          // Maximum decimal digits for vote representation
 	VoteMod    = 1000000000 // 10^9 modulus for vote arithmetic
+	MaxVote    = 64         // Largest value accepted by EncryptVote
 )
 
 // EncryptVote encrypts a single numeric vote using the common domain approach.
-// The vote value must be in the range [0, 64] for compatibility with the voting system.
+// The vote value must be in the range [0, MaxVote] for compatibility with the voting system.
 // If r is nil, a fresh random value is generated for probabilistic encryption.
 func EncryptVote(pk *PublicKey, vote uint64, r *big.Int) (*Ciphertext, *big.Int, error) {
-	if vote > 64 {
+	if vote > MaxVote {
 		return nil, nil, fmt.Errorf("vote out of range")
 	}
 	msgDigits := fmt.Sprintf("%0*d", VoteDigits, vote)
@@ -38,19 +40,44 @@ func DecryptVote(sk *PrivateKey, ct *Ciphertext) (uint64, error) {
 	return i.Uint64(), nil
 }
 
+// DecryptVoteSigned recovers a vote tally under the signed interpretation of
+// the plaintext space: values in [10^n/2, 10^n) represent negative numbers,
+// as produced by Ciphertext.Neg and Ciphertext.Sub.
+func DecryptVoteSigned(sk *PrivateKey, ct *Ciphertext) (int64, error) {
+	plain, err := decryptDigits(sk, ct)
+	if err != nil {
+		return 0, err
+	}
+	i, ok := new(big.Int).SetString(plain, 10)
+	if !ok {
+		return 0, fmt.Errorf("invalid decimal in plaintext")
+	}
+	capacity := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(len(plain))), nil)
+	if new(big.Int).Lsh(i, 1).Cmp(capacity) >= 0 {
+		i.Sub(i, capacity)
+	}
+	return i.Int64(), nil
+}
+
+// encryptVoteRandom encrypts vote with a fresh randomness factor read from
+// random, so that callers supplying their own source stay reproducible.
+func encryptVoteRandom(pk *PublicKey, vote uint64, random io.Reader) (*Ciphertext, *big.Int, error) {
+	r, err := randomFactor(random)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encryptDigits(pk, fmt.Sprintf("%0*d", VoteDigits, vote), r)
+}
+
 // encryptDigits encrypts a decimal string using the common domain approach.
 // This internal function handles the core encryption logic for numeric values,
 // ensuring all arithmetic is performed in the unified domain D = 2^P · 5^n.
 func encryptDigits(pk *PublicKey, msgDigits string, r *big.Int) (*Ciphertext, *big.Int, error) {
 	if r == nil {
 		var err error
-		r, err = rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
-		if err != nil {
+		if r, err = randomFactor(rand.Reader); err != nil {
 			return nil, nil, err
 		}
-		if r.Sign() == 0 {
-			r.Add(r, big.NewInt(1))
-		}
 	}
 	n := len(msgDigits)
 
@@ -67,8 +94,14 @@ func encryptDigits(pk *PublicKey, msgDigits string, r *big.Int) (*Ciphertext, *b
 	}
 
 	messageInt, _ := new(big.Int).SetString(msgDigits, 10)
-	scaleFactor := new(big.Int).Lsh(big.NewInt(1), uint(pk.Prec)-uint(n))
-	M := new(big.Int).Mul(messageInt, scaleFactor)
+	return encryptInt(pk, messageInt, r), r, nil
+}
+
+// encryptInt computes the vote ciphertext (r · X mod D, (m · 2^(P-n) + r · H) mod D)
+// for an already validated integer plaintext m. The map (m, r) -> ciphertext is
+// linear over Z_D, which is what the zero-knowledge proofs in this package rely on.
+func encryptInt(pk *PublicKey, m, r *big.Int) *Ciphertext {
+	M := new(big.Int).Mul(m, voteScale(pk))
 
 	c1 := new(big.Int).Mul(r, pk.XInt)
 	c1.Mod(c1, pk.D)
@@ -79,7 +112,13 @@ func encryptDigits(pk *PublicKey, msgDigits string, r *big.Int) (*Ciphertext, *b
 	c2 := new(big.Int).Add(M, rH)
 	c2.Mod(c2, pk.D)
 
-	return &Ciphertext{c1: c1, c2: c2, d: new(big.Int).Set(pk.D), n: uint(n)}, r, nil
+	return &Ciphertext{c1: c1, c2: c2, d: new(big.Int).Set(pk.D), n: VoteDigits}
+}
+
+// voteScale returns the factor 2^(P-n) that lifts a VoteDigits-digit plaintext
+// into the common domain D.
+func voteScale(pk *PublicKey) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(pk.Prec)-VoteDigits)
 }
 
 // decryptDigits recovers the raw decimal string from a ciphertext.
@@ -115,5 +154,7 @@ func decryptDigits(sk *PrivateKey, ct *Ciphertext) (string, error) {
 		}
 	}
 
+	messageInt.Mod(messageInt, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil))
+
 	return fmt.Sprintf("%0*d", int(n), messageInt), nil
 }
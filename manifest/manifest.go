@@ -0,0 +1,284 @@
+// Package manifest defines the election manifest: the machine-readable
+// description of what every ciphertext of an election means.
+//
+// A manifest lists the questions with their options and ballot modes, the
+// m1fp parameter set, the election public key and the trustees. It has a
+// single canonical encoding, the JSON Canonicalization Scheme of RFC 8785
+// implemented by package canonical, and the SHA-256 hash of that encoding
+// identifies the election. Ballot proofs are bound to the manifest hash
+// through the context returned by Question.Context, and results carry the
+// hash as well, so a ciphertext cannot be reinterpreted under another
+// election.
+package manifest
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/p4u/m1fp-go/canonical"
+	"github.com/p4u/m1fp-go/m1fp"
+)
+
+// Version is the manifest format version produced and accepted by this package.
+const Version = 1
+
+// Ranked ballot modes handled by the manifest on top of m1fp.BallotSpec.
+const (
+	// ModeBorda questions take m1fp.BordaBallot rankings.
+	ModeBorda m1fp.BallotMode = "borda"
+	// ModeCondorcet questions take m1fp.CondorcetBallot rankings.
+	ModeCondorcet m1fp.BallotMode = "condorcet"
+)
+
+// Manifest describes one election.
+type Manifest struct {
+	Version    int        `json:"version"`
+	ElectionID string     `json:"election_id"`
+	Title      string     `json:"title"`
+	Parameters Parameters `json:"parameters"`
+	PublicKey  []byte     `json:"public_key"` // PublicKey.MarshalBinary, base64 in JSON
+	Trustees   []Trustee  `json:"trustees"`
+	Questions  []Question `json:"questions"`
+}
+
+// Parameters is the m1fp parameter set of the election.
+type Parameters struct {
+	Precision      uint16 `json:"precision"`       // P, in bits
+	Digits         uint16 `json:"digits"`          // n, decimal digits of the vote plaintext
+	X              string `json:"x"`               // Irrational public parameter passed to KeyGen
+	RandomnessBits int    `json:"randomness_bits"` // Size of the encryption randomness
+}
+
+// DefaultParameters returns the parameters used by m1fp.KeyGen(256, m1fp.X).
+func DefaultParameters() Parameters {
+	return Parameters{Precision: 256, Digits: m1fp.VoteDigits, X: m1fp.X, RandomnessBits: m1fp.RandomnessBits}
+}
+
+// Trustee is a holder of election key material, identified by an Ed25519
+// key used to sign its contributions.
+type Trustee struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	PublicKey []byte `json:"public_key"` // Ed25519 public key, base64 in JSON
+}
+
+// Question is one contest of the election. MaxScore, Budget and ExactBudget
+// carry the value ranges of score and cumulative questions, with the same
+// meaning as in m1fp.BallotSpec.
+type Question struct {
+	ID          string          `json:"id"`
+	Title       string          `json:"title"`
+	Options     []string        `json:"options"`
+	Mode        m1fp.BallotMode `json:"mode"`
+	MaxScore    uint64          `json:"max_score,omitempty"`
+	Budget      uint64          `json:"budget,omitempty"`
+	ExactBudget bool            `json:"exact_budget,omitempty"`
+}
+
+// Hash is the SHA-256 hash of the canonical encoding of a manifest.
+type Hash [sha256.Size]byte
+
+// String returns the hash in hexadecimal.
+func (h Hash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+// MarshalText encodes the hash in hexadecimal.
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// UnmarshalText decodes a hexadecimal hash.
+func (h *Hash) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(string(text))
+	if err != nil {
+		return fmt.Errorf("manifest hash: %w", err)
+	}
+	if len(b) != len(h) {
+		return fmt.Errorf("manifest hash must be %d bytes", len(h))
+	}
+	copy(h[:], b)
+	return nil
+}
+
+// Parse decodes and validates a JSON manifest. Unknown fields are rejected,
+// so that everything a verifier reads is covered by the hash.
+func Parse(data []byte) (*Manifest, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	m := new(Manifest)
+	if err := dec.Decode(m); err != nil {
+		return nil, fmt.Errorf("manifest: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("manifest: trailing data")
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Canonical returns the canonical encoding of the manifest: its JSON
+// encoding in RFC 8785 canonical form, with members sorted by name and no
+// insignificant whitespace. Manifests that differ only in formatting or
+// member order have the same canonical encoding.
+func (m *Manifest) Canonical() ([]byte, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return canonical.Marshal(m)
+}
+
+// Hash returns the SHA-256 hash of the canonical encoding.
+func (m *Manifest) Hash() (Hash, error) {
+	data, err := m.Canonical()
+	if err != nil {
+		return Hash{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+// Key decodes the election public key.
+func (m *Manifest) Key() (*m1fp.PublicKey, error) {
+	pk := new(m1fp.PublicKey)
+	if err := pk.UnmarshalBinary(m.PublicKey); err != nil {
+		return nil, fmt.Errorf("manifest public key: %w", err)
+	}
+	return pk, nil
+}
+
+// Question returns the question with the given ID.
+func (m *Manifest) Question(id string) (*Question, error) {
+	for i := range m.Questions {
+		if m.Questions[i].ID == id {
+			return &m.Questions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown question %q", id)
+}
+
+// Validate checks that the manifest is complete and self-consistent.
+func (m *Manifest) Validate() error {
+	if m.Version != Version {
+		return fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	if m.ElectionID == "" {
+		return fmt.Errorf("manifest needs an election_id")
+	}
+	if err := m.Parameters.validate(); err != nil {
+		return err
+	}
+	pk, err := m.Key()
+	if err != nil {
+		return err
+	}
+	if pk.Prec != m.Parameters.Precision || pk.N != m.Parameters.Digits {
+		return fmt.Errorf("public key does not match the parameter set")
+	}
+
+	if len(m.Trustees) == 0 {
+		return fmt.Errorf("manifest needs at least one trustee")
+	}
+	trustees := make(map[string]bool, len(m.Trustees))
+	for i, t := range m.Trustees {
+		if t.ID == "" || trustees[t.ID] {
+			return fmt.Errorf("trustee %d: missing or duplicate id %q", i, t.ID)
+		}
+		if len(t.PublicKey) != ed25519.PublicKeySize {
+			return fmt.Errorf("trustee %q: public key must be %d bytes", t.ID, ed25519.PublicKeySize)
+		}
+		trustees[t.ID] = true
+	}
+
+	if len(m.Questions) == 0 {
+		return fmt.Errorf("manifest needs at least one question")
+	}
+	questions := make(map[string]bool, len(m.Questions))
+	for i, q := range m.Questions {
+		if q.ID == "" || questions[q.ID] {
+			return fmt.Errorf("question %d: missing or duplicate id %q", i, q.ID)
+		}
+		if err := q.validate(); err != nil {
+			return fmt.Errorf("question %q: %w", q.ID, err)
+		}
+		questions[q.ID] = true
+	}
+	return nil
+}
+
+// validate checks the parameter set against what this build of m1fp supports.
+func (p Parameters) validate() error {
+	if p.Precision < 128 {
+		return fmt.Errorf("precision too small")
+	}
+	if p.Digits != m1fp.VoteDigits {
+		return fmt.Errorf("vote plaintexts must have %d digits", m1fp.VoteDigits)
+	}
+	if p.X == "" {
+		return fmt.Errorf("parameters need the public irrational x")
+	}
+	if p.RandomnessBits != m1fp.RandomnessBits {
+		return fmt.Errorf("randomness must be %d bits", m1fp.RandomnessBits)
+	}
+	return nil
+}
+
+// Ranked reports whether the question takes rankings, i.e. Borda or
+// Condorcet ballots, rather than an m1fp.Ballot.
+func (q *Question) Ranked() bool {
+	return q.Mode == ModeBorda || q.Mode == ModeCondorcet
+}
+
+// Context returns the context that ballot proofs for q are bound to in the
+// election identified by h: the manifest hash followed by the question ID.
+func (q *Question) Context(h Hash) []byte {
+	return append(h[:], q.ID...)
+}
+
+// Spec returns the ballot spec of a non-ranked question, bound to the
+// election identified by h.
+func (q *Question) Spec(h Hash) (m1fp.BallotSpec, error) {
+	if q.Ranked() {
+		return m1fp.BallotSpec{}, fmt.Errorf("%s question has no ballot spec", q.Mode)
+	}
+	s := m1fp.BallotSpec{
+		Mode:        q.Mode,
+		Options:     len(q.Options),
+		MaxScore:    q.MaxScore,
+		Budget:      q.Budget,
+		ExactBudget: q.ExactBudget,
+		Context:     q.Context(h),
+	}
+	if err := s.Validate(); err != nil {
+		return m1fp.BallotSpec{}, err
+	}
+	return s, nil
+}
+
+// validate checks the options and the value ranges of the question.
+func (q *Question) validate() error {
+	options := make(map[string]bool, len(q.Options))
+	for i, o := range q.Options {
+		if o == "" || options[o] {
+			return fmt.Errorf("option %d: missing or duplicate label %q", i, o)
+		}
+		options[o] = true
+	}
+	if !q.Ranked() {
+		_, err := q.Spec(Hash{})
+		return err
+	}
+	if len(q.Options) < 2 {
+		return fmt.Errorf("%s questions need at least two options", q.Mode)
+	}
+	if q.MaxScore != 0 || q.Budget != 0 || q.ExactBudget {
+		return fmt.Errorf("%s questions take no value range", q.Mode)
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package manifest
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/p4u/m1fp-go/m1fp"
+)
+
+func testManifest(t *testing.T) (*m1fp.PrivateKey, *Manifest) {
+	t.Helper()
+	sk, pk, err := m1fp.KeyGen(256, m1fp.X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+	pkBytes, err := pk.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	trusteeKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	m := &Manifest{
+		Version:    Version,
+		ElectionID: "city-2026",
+		Title:      "City referendum <2026>",
+		Parameters: DefaultParameters(),
+		PublicKey:  pkBytes,
+		Trustees:   []Trustee{{ID: "t1", Name: "Electoral board", PublicKey: trusteeKey}},
+		Questions: []Question{
+			{ID: "mayor", Title: "Mayor", Options: []string{"Ada", "Bob", "Cy"}, Mode: m1fp.ModePlurality},
+			{ID: "budget", Title: "Budget", Options: []string{"Parks", "Roads"}, Mode: m1fp.ModeCumulative, Budget: 5},
+			{ID: "council", Title: "Council", Options: []string{"A", "B", "C"}, Mode: ModeBorda},
+		},
+	}
+	if err := m.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	return sk, m
+}
+
+func TestManifestCanonicalHash(t *testing.T) {
+	_, m := testManifest(t)
+	h, err := m.Hash()
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+
+	canonical, err := m.Canonical()
+	if err != nil {
+		t.Fatalf("Canonical failed: %v", err)
+	}
+	if !bytes.Contains(canonical, []byte("<2026>")) {
+		t.Fatalf("canonical encoding escapes HTML: %s", canonical)
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, canonical, "", "  "); err != nil {
+		t.Fatalf("Indent failed: %v", err)
+	}
+	parsed, err := Parse(indented.Bytes())
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got, _ := parsed.Hash(); got != h {
+		t.Fatalf("reformatted manifest hashes to %s, want %s", got, h)
+	}
+
+	var roundTrip Hash
+	if err := roundTrip.UnmarshalText([]byte(h.String())); err != nil || roundTrip != h {
+		t.Fatalf("hash text round trip failed: %v", err)
+	}
+
+	parsed.Questions[0].Options[2] = "Cyd"
+	if got, _ := parsed.Hash(); got == h {
+		t.Fatalf("changing an option did not change the hash")
+	}
+}
+
+func TestManifestCanonicalKnownAnswer(t *testing.T) {
+	m := &Manifest{
+		Version:    Version,
+		ElectionID: "kat",
+		Title:      "Café <1>",
+		Parameters: Parameters{Precision: 256, Digits: m1fp.VoteDigits, X: "1.4142135623730951", RandomnessBits: m1fp.RandomnessBits},
+		PublicKey:  []byte{0x01, 0x00, 0x00, 0x09, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x03, 0x05},
+		Trustees:   []Trustee{{ID: "t1", Name: "Board", PublicKey: bytes.Repeat([]byte{7}, ed25519.PublicKeySize)}},
+		Questions: []Question{
+			{ID: "q1", Title: "Yes or no", Options: []string{"yes", "no"}, Mode: m1fp.ModePlurality},
+			{ID: "q2", Title: "Split", Options: []string{"a", "b"}, Mode: m1fp.ModeCumulative, Budget: 3, ExactBudget: true},
+		},
+	}
+	want := `{"election_id":"kat",` +
+		`"parameters":{"digits":9,"precision":256,"randomness_bits":64,"x":"1.4142135623730951"},` +
+		`"public_key":"AQAACQAAAAEAAAABAwU=",` +
+		`"questions":[{"id":"q1","mode":"plurality","options":["yes","no"],"title":"Yes or no"},` +
+		`{"budget":3,"exact_budget":true,"id":"q2","mode":"cumulative","options":["a","b"],"title":"Split"}],` +
+		`"title":"Café <1>",` +
+		`"trustees":[{"id":"t1","name":"Board","public_key":"BwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwc="}],` +
+		`"version":1}`
+	got, err := m.Canonical()
+	if err != nil {
+		t.Fatalf("Canonical failed: %v", err)
+	}
+	if string(got) != want {
+		t.Fatalf("canonical encoding\n got %s\nwant %s", got, want)
+	}
+	h, err := m.Hash()
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+	if h != sha256.Sum256([]byte(want)) {
+		t.Fatalf("hash %s is not the SHA-256 hash of the canonical encoding", h)
+	}
+}
+
+func TestManifestParseRejects(t *testing.T) {
+	_, m := testManifest(t)
+	canonical, err := m.Canonical()
+	if err != nil {
+		t.Fatalf("Canonical failed: %v", err)
+	}
+
+	unknown := strings.Replace(string(canonical), `"title"`, `"note":"x","title"`, 1)
+	if _, err := Parse([]byte(unknown)); err == nil {
+		t.Fatalf("manifest with unknown field accepted")
+	}
+	duplicate := strings.Replace(string(canonical), `"id":"budget"`, `"id":"mayor"`, 1)
+	if _, err := Parse([]byte(duplicate)); err == nil {
+		t.Fatalf("manifest with duplicate question accepted")
+	}
+	ranged := strings.Replace(string(canonical), `"mode":"borda"`, `"mode":"borda","budget":3`, 1)
+	if _, err := Parse([]byte(ranged)); err == nil {
+		t.Fatalf("borda question with a budget accepted")
+	}
+}
+
+func TestBallotsBindToManifest(t *testing.T) {
+	_, m := testManifest(t)
+	pk, err := m.Key()
+	if err != nil {
+		t.Fatalf("Key failed: %v", err)
+	}
+	h, err := m.Hash()
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+
+	other := *m
+	other.ElectionID = "city-2027"
+	otherHash, err := other.Hash()
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+
+	q, _ := m.Question("mayor")
+	spec, err := q.Spec(h)
+	if err != nil {
+		t.Fatalf("Spec failed: %v", err)
+	}
+	b, err := spec.Encrypt(pk, []uint64{0, 1, 0}, rand.Reader)
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if err := spec.Verify(pk, b); err != nil {
+		t.Fatalf("valid ballot rejected: %v", err)
+	}
+
+	replayed, _ := q.Spec(otherHash)
+	if err := replayed.Verify(pk, b); err == nil {
+		t.Fatalf("ballot accepted under another manifest")
+	}
+	b.Context = replayed.Context
+	if err := replayed.Verify(pk, b); err == nil {
+		t.Fatalf("relabelled ballot accepted under another manifest")
+	}
+
+	council, _ := m.Question("council")
+	if _, err := council.Spec(h); err == nil {
+		t.Fatalf("borda question returned a ballot spec")
+	}
+	borda, err := m1fp.EncryptBorda(pk, []int{2, 0, 1}, council.Context(h), rand.Reader)
+	if err != nil {
+		t.Fatalf("EncryptBorda failed: %v", err)
+	}
+	if err := m1fp.VerifyBorda(pk, 3, council.Context(h), borda); err != nil {
+		t.Fatalf("valid borda ballot rejected: %v", err)
+	}
+	if err := m1fp.VerifyBorda(pk, 3, q.Context(h), borda); err == nil {
+		t.Fatalf("borda ballot accepted for another question")
+	}
+}
+
+func TestResultCommitsToManifest(t *testing.T) {
+	_, m := testManifest(t)
+	r, err := m.NewResult("mayor", []uint64{3, 1, 4})
+	if err != nil {
+		t.Fatalf("NewResult failed: %v", err)
+	}
+	if err := m.CheckResult(r); err != nil {
+		t.Fatalf("valid result rejected: %v", err)
+	}
+	if _, err := m.NewResult("mayor", []uint64{3, 1}); err == nil {
+		t.Fatalf("result with missing counts accepted")
+	}
+
+	other := *m
+	other.Title = "Another election"
+	if err := other.CheckResult(r); err == nil {
+		t.Fatalf("result accepted under another manifest")
+	}
+}
@@ -0,0 +1,55 @@
+package manifest
+
+import "fmt"
+
+// Result is the decrypted outcome of one question. It names the manifest it
+// was computed under, so counts cannot be presented as the outcome of
+// another election or question.
+type Result struct {
+	ManifestHash Hash     `json:"manifest_hash"`
+	QuestionID   string   `json:"question_id"`
+	Counts       []uint64 `json:"counts"` // See Question.ResultSize
+}
+
+// NewResult returns the result of question id with the given counts.
+func (m *Manifest) NewResult(id string, counts []uint64) (*Result, error) {
+	h, err := m.Hash()
+	if err != nil {
+		return nil, err
+	}
+	r := &Result{ManifestHash: h, QuestionID: id, Counts: counts}
+	if err := m.CheckResult(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// CheckResult checks that r commits to this manifest and has the number of
+// counts its question calls for.
+func (m *Manifest) CheckResult(r *Result) error {
+	h, err := m.Hash()
+	if err != nil {
+		return err
+	}
+	if r == nil || r.ManifestHash != h {
+		return fmt.Errorf("result belongs to another manifest")
+	}
+	q, err := m.Question(r.QuestionID)
+	if err != nil {
+		return err
+	}
+	if len(r.Counts) != q.ResultSize() {
+		return fmt.Errorf("question %q: result must have %d counts", q.ID, q.ResultSize())
+	}
+	return nil
+}
+
+// ResultSize returns the number of counts in a result of q: one per option,
+// in manifest order, except for Condorcet questions whose result is the
+// pairwise-preference matrix in row-major order.
+func (q *Question) ResultSize() int {
+	if q.Mode == ModeCondorcet {
+		return len(q.Options) * len(q.Options)
+	}
+	return len(q.Options)
+}
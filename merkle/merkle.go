@@ -0,0 +1,273 @@
+// Package merkle implements the Merkle tree of RFC 6962 (Certificate
+// Transparency) used by the bulletin board: leaves are hashed as
+// SHA-256(0x00 || data), interior nodes as SHA-256(0x01 || left || right),
+// and a tree of n leaves splits at the largest power of two below n.
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+)
+
+// Hash is a node of the tree.
+type Hash [sha256.Size]byte
+
+// String returns the hash in hexadecimal.
+func (h Hash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+// MarshalText encodes the hash in hexadecimal.
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// UnmarshalText decodes a hexadecimal hash.
+func (h *Hash) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(string(text))
+	if err != nil {
+		return fmt.Errorf("merkle hash: %w", err)
+	}
+	if len(b) != len(h) {
+		return fmt.Errorf("merkle hash must be %d bytes", len(h))
+	}
+	copy(h[:], b)
+	return nil
+}
+
+// LeafHash returns the hash of a leaf holding data.
+func LeafHash(data []byte) Hash {
+	return sha256.Sum256(append([]byte{0x00}, data...))
+}
+
+// NodeHash returns the hash of an interior node.
+func NodeHash(left, right Hash) Hash {
+	buf := make([]byte, 0, 1+2*sha256.Size)
+	buf = append(buf, 0x01)
+	buf = append(buf, left[:]...)
+	buf = append(buf, right[:]...)
+	return sha256.Sum256(buf)
+}
+
+// Tree is an append-only Merkle tree over leaf hashes. It caches the root
+// of every complete subtree, so roots and proofs take O(log² n) hashes.
+type Tree struct {
+	// nodes[h][i] is the root of the complete subtree of 2^h leaves starting
+	// at leaf i·2^h; nodes[0] holds the leaf hashes.
+	nodes [][]Hash
+}
+
+// Append adds a leaf holding data and returns its index.
+func (t *Tree) Append(data []byte) uint64 {
+	if len(t.nodes) == 0 {
+		t.nodes = [][]Hash{nil}
+	}
+	t.nodes[0] = append(t.nodes[0], LeafHash(data))
+	index := uint64(len(t.nodes[0]) - 1)
+	// Every subtree the new leaf completes gets its root cached.
+	for h, i := 0, index; i%2 == 1; h, i = h+1, i/2 {
+		if len(t.nodes) == h+1 {
+			t.nodes = append(t.nodes, nil)
+		}
+		t.nodes[h+1] = append(t.nodes[h+1], NodeHash(t.nodes[h][i-1], t.nodes[h][i]))
+	}
+	return index
+}
+
+// Size returns the number of leaves.
+func (t *Tree) Size() uint64 {
+	if len(t.nodes) == 0 {
+		return 0
+	}
+	return uint64(len(t.nodes[0]))
+}
+
+// Root returns the root of the whole tree.
+func (t *Tree) Root() Hash {
+	return t.root(0, t.Size())
+}
+
+// RootAt returns the root of the tree formed by the first size leaves.
+func (t *Tree) RootAt(size uint64) (Hash, error) {
+	if size > t.Size() {
+		return Hash{}, fmt.Errorf("tree size %d beyond %d leaves", size, t.Size())
+	}
+	return t.root(0, size), nil
+}
+
+// InclusionProof returns the audit path of leaf index in the tree formed by
+// the first size leaves.
+func (t *Tree) InclusionProof(index, size uint64) ([]Hash, error) {
+	if size > t.Size() {
+		return nil, fmt.Errorf("tree size %d beyond %d leaves", size, t.Size())
+	}
+	if index >= size {
+		return nil, fmt.Errorf("leaf %d outside tree of size %d", index, size)
+	}
+	return t.path(index, 0, size), nil
+}
+
+// VerifyInclusion checks that leaf is at index in the tree of the given size
+// and root, following the algorithm of RFC 9162, section 2.1.3.2.
+func VerifyInclusion(leaf Hash, index, size uint64, proof []Hash, want Hash) error {
+	if index >= size {
+		return fmt.Errorf("leaf %d outside tree of size %d", index, size)
+	}
+	fn, sn := index, size-1
+	r := leaf
+	for _, p := range proof {
+		if sn == 0 {
+			return fmt.Errorf("inclusion proof too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			r = NodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = NodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return fmt.Errorf("inclusion proof too short")
+	}
+	if !bytes.Equal(r[:], want[:]) {
+		return fmt.Errorf("inclusion proof does not match the root")
+	}
+	return nil
+}
+
+// ConsistencyProof returns the proof that the tree of the first first leaves
+// is a prefix of the tree of the first second leaves.
+func (t *Tree) ConsistencyProof(first, second uint64) ([]Hash, error) {
+	if second > t.Size() {
+		return nil, fmt.Errorf("tree size %d beyond %d leaves", second, t.Size())
+	}
+	if first > second {
+		return nil, fmt.Errorf("tree size %d larger than %d", first, second)
+	}
+	if first == 0 || first == second {
+		return nil, nil
+	}
+	return t.subproof(first, 0, second, true), nil
+}
+
+// Clone returns an independent copy of the tree.
+func (t *Tree) Clone() *Tree {
+	c := &Tree{nodes: make([][]Hash, len(t.nodes))}
+	for h, level := range t.nodes {
+		c.nodes[h] = append([]Hash(nil), level...)
+	}
+	return c
+}
+
+// VerifyConsistency checks that the tree of size first and root firstRoot
+// is a prefix of the tree of size second and root secondRoot, following the
+// algorithm of RFC 9162, section 2.1.4.2.
+func VerifyConsistency(first, second uint64, firstRoot, secondRoot Hash, proof []Hash) error {
+	switch {
+	case first > second:
+		return fmt.Errorf("tree size %d larger than %d", first, second)
+	case first == second:
+		if len(proof) != 0 || firstRoot != secondRoot {
+			return fmt.Errorf("trees of equal size %d differ", first)
+		}
+		return nil
+	case first == 0:
+		if len(proof) != 0 {
+			return fmt.Errorf("consistency proof from the empty tree must be empty")
+		}
+		return nil
+	case len(proof) == 0:
+		return fmt.Errorf("empty consistency proof")
+	}
+
+	if first&(first-1) == 0 {
+		proof = append([]Hash{firstRoot}, proof...)
+	}
+	fn, sn := first-1, second-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return fmt.Errorf("consistency proof too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = NodeHash(c, fr)
+			sr = NodeHash(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = NodeHash(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return fmt.Errorf("consistency proof too short")
+	}
+	if fr != firstRoot || sr != secondRoot {
+		return fmt.Errorf("consistency proof does not match the roots")
+	}
+	return nil
+}
+
+// root computes MTH over the n leaves from lo; the empty tree hashes the
+// empty string. The recursion of RFC 6962 only meets complete subtrees at
+// offsets aligned to their size, whose roots are cached.
+func (t *Tree) root(lo, n uint64) Hash {
+	switch {
+	case n == 0:
+		return sha256.Sum256(nil)
+	case n&(n-1) == 0:
+		h := bits.TrailingZeros64(n)
+		return t.nodes[h][lo>>h]
+	}
+	k := split(n)
+	return NodeHash(t.root(lo, k), t.root(lo+k, n-k))
+}
+
+// path computes PATH(m, D[n]) of RFC 6962, section 2.1.1, over the n leaves
+// from lo.
+func (t *Tree) path(m, lo, n uint64) []Hash {
+	if n <= 1 {
+		return nil
+	}
+	k := split(n)
+	if m < k {
+		return append(t.path(m, lo, k), t.root(lo+k, n-k))
+	}
+	return append(t.path(m-k, lo+k, n-k), t.root(lo, k))
+}
+
+// subproof computes SUBPROOF(m, D[n], b) of RFC 6962, section 2.1.2, over
+// the n leaves from lo.
+func (t *Tree) subproof(m, lo, n uint64, complete bool) []Hash {
+	if m == n {
+		if complete {
+			return nil
+		}
+		return []Hash{t.root(lo, n)}
+	}
+	k := split(n)
+	if m <= k {
+		return append(t.subproof(m, lo, k, complete), t.root(lo+k, n-k))
+	}
+	return append(t.subproof(m-k, lo+k, n-k, false), t.root(lo, k))
+}
+
+// split returns the largest power of two smaller than n, for n > 1.
+func split(n uint64) uint64 {
+	return 1 << (bits.Len64(n-1) - 1)
+}
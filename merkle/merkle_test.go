@@ -0,0 +1,152 @@
+package merkle
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// rfc6962Leaves are the leaf inputs of the Certificate Transparency test vectors.
+var rfc6962Leaves = [][]byte{
+	{},
+	{0x00},
+	{0x10},
+	{0x20, 0x21},
+	{0x30, 0x31},
+	{0x40, 0x41, 0x42, 0x43},
+	{0x50, 0x51, 0x52, 0x53, 0x54, 0x55, 0x56, 0x57},
+	{0x60, 0x61, 0x62, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69, 0x6a, 0x6b, 0x6c, 0x6d, 0x6e, 0x6f},
+}
+
+// rfc6962Roots[i] is the root of the tree over the first i+1 leaves.
+var rfc6962Roots = []string{
+	"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+	"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+	"aeb6bcfe274b70a14fb067a5e5578264db0fa9b51af5e0ba159158f329e06e77",
+	"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+	"4e3bbb1f7b478dcfe71fb631631519a3bca12c9aefca1612bfce4c13a86264d4",
+	"76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef",
+	"ddb89be403809e325750d3d263cd78929c2942b7942a34b77e122c9594a74c8c",
+	"5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328",
+}
+
+func testTree() *Tree {
+	t := new(Tree)
+	for _, leaf := range rfc6962Leaves {
+		t.Append(leaf)
+	}
+	return t
+}
+
+func TestRootKnownAnswers(t *testing.T) {
+	tree := testTree()
+	if got := new(Tree).Root().String(); got != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Fatalf("empty root: got %s", got)
+	}
+	for i, want := range rfc6962Roots {
+		got, err := tree.RootAt(uint64(i + 1))
+		if err != nil {
+			t.Fatalf("RootAt failed: %v", err)
+		}
+		if got.String() != want {
+			t.Fatalf("root of %d leaves: got %s, want %s", i+1, got, want)
+		}
+	}
+}
+
+func TestInclusionProofs(t *testing.T) {
+	tree := testTree()
+	for size := uint64(1); size <= tree.Size(); size++ {
+		root, _ := tree.RootAt(size)
+		for index := range size {
+			proof, err := tree.InclusionProof(index, size)
+			if err != nil {
+				t.Fatalf("InclusionProof(%d, %d) failed: %v", index, size, err)
+			}
+			leaf := LeafHash(rfc6962Leaves[index])
+			if err := VerifyInclusion(leaf, index, size, proof, root); err != nil {
+				t.Fatalf("leaf %d of %d rejected: %v", index, size, err)
+			}
+			if size > 1 {
+				if err := VerifyInclusion(leaf, (index+1)%size, size, proof, root); err == nil {
+					t.Fatalf("leaf %d of %d accepted at the wrong index", index, size)
+				}
+			}
+			if err := VerifyInclusion(LeafHash([]byte("forged")), index, size, proof, root); err == nil {
+				t.Fatalf("forged leaf accepted at %d of %d", index, size)
+			}
+		}
+	}
+}
+
+func TestConsistencyProofs(t *testing.T) {
+	tree := testTree()
+	for second := uint64(0); second <= tree.Size(); second++ {
+		secondRoot, _ := tree.RootAt(second)
+		for first := uint64(0); first <= second; first++ {
+			firstRoot, _ := tree.RootAt(first)
+			proof, err := tree.ConsistencyProof(first, second)
+			if err != nil {
+				t.Fatalf("ConsistencyProof(%d, %d) failed: %v", first, second, err)
+			}
+			if err := VerifyConsistency(first, second, firstRoot, secondRoot, proof); err != nil {
+				t.Fatalf("consistency %d -> %d rejected: %v", first, second, err)
+			}
+			if first == 0 || first == second {
+				continue
+			}
+			// A forked first tree of the same size must not verify.
+			forked := new(Tree)
+			for i := range first - 1 {
+				forked.Append(rfc6962Leaves[i])
+			}
+			forked.Append([]byte("forged"))
+			forkedRoot, _ := forked.RootAt(first)
+			if err := VerifyConsistency(first, second, forkedRoot, secondRoot, proof); err == nil {
+				t.Fatalf("forked tree of size %d accepted as prefix of %d", first, second)
+			}
+		}
+	}
+}
+
+// referenceRoot computes MTH directly from the definition of RFC 6962.
+func referenceRoot(leaves []Hash) Hash {
+	switch len(leaves) {
+	case 0:
+		return LeafHash(nil)
+	case 1:
+		return leaves[0]
+	}
+	k := split(uint64(len(leaves)))
+	return NodeHash(referenceRoot(leaves[:k]), referenceRoot(leaves[k:]))
+}
+
+func TestCachedTreeMatchesDefinition(t *testing.T) {
+	var tree Tree
+	var leaves []Hash
+	for n := uint64(1); n <= 100; n++ {
+		data := binary.BigEndian.AppendUint64(nil, n)
+		tree.Append(data)
+		leaves = append(leaves, LeafHash(data))
+		if got, want := tree.Root(), referenceRoot(leaves); got != want {
+			t.Fatalf("root of %d leaves: got %s, want %s", n, got, want)
+		}
+	}
+	size := tree.Size()
+	root := tree.Root()
+	for _, index := range []uint64{0, 31, 32, 63, 64, 99} {
+		proof, err := tree.InclusionProof(index, size)
+		if err != nil {
+			t.Fatalf("InclusionProof(%d, %d) failed: %v", index, size, err)
+		}
+		if err := VerifyInclusion(leaves[index], index, size, proof, root); err != nil {
+			t.Fatalf("leaf %d of %d rejected: %v", index, size, err)
+		}
+	}
+	for _, first := range []uint64{1, 33, 64, 65, 99} {
+		firstRoot, _ := tree.RootAt(first)
+		proof, _ := tree.ConsistencyProof(first, size)
+		if err := VerifyConsistency(first, size, firstRoot, root, proof); err != nil {
+			t.Fatalf("consistency %d -> %d rejected: %v", first, size, err)
+		}
+	}
+}
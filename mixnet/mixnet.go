@@ -0,0 +1,331 @@
+// Package mixnet implements a verifiable re-encryption mixnet for m1fp
+// ciphertexts that cannot be tallied homomorphically, such as write-in
+// answers encrypted with m1fp.Encrypt.
+//
+// Every mix server re-randomizes and permutes the batch it receives and
+// publishes a cut-and-choose shuffle proof in the style of Sako and Kilian,
+// made non-interactive with a Fiat–Shamir transcript. For each round the
+// server commits to a shadow shuffle of its input; a challenge bit then asks
+// it to open either the input→shadow or the shadow→output mapping. Since the
+// real permutation is never revealed, the cascade stays private as long as one
+// server is honest, and a cheating server is caught with probability
+// 1 - 2^-Rounds.
+//
+// Re-randomization adds to the decryption noise, so every revealed factor is
+// bounded: a shuffle that verifies adds less than 2^(RandomnessBits +
+// SlackBits) to the randomness of each ciphertext, and VerifyCascade rejects
+// cascades that could push inputs encrypted with randomness below
+// 2^RandomnessBits, as drawn by m1fp.Encrypt and m1fp.EncryptVote, past the
+// noise budget of the key.
+package mixnet
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/p4u/m1fp-go/m1fp"
+	"github.com/p4u/m1fp-go/transcript"
+)
+
+// Rounds is the number of cut-and-choose rounds in a shuffle proof.
+const Rounds = 128
+
+// SlackBits is the statistical slack of the revealed factors: shadow factors
+// are drawn below 2^(RandomnessBits+SlackBits) + 2^RandomnessBits, and only
+// openings with factors below 2^(RandomnessBits+SlackBits) in absolute value
+// are accepted, so they reveal nothing about the real factors.
+const SlackBits = 24
+
+// Shuffle is the output batch of one mix server with its proof.
+type Shuffle struct {
+	Output []*m1fp.Ciphertext
+	Proof  *Proof
+}
+
+// Proof is a non-interactive cut-and-choose shuffle proof.
+type Proof struct {
+	Shadows  [][]*m1fp.Ciphertext // One committed shadow batch per round
+	Openings []*Opening           // One opening per round, chosen by the challenge
+}
+
+// Opening reveals one side of a round: Destination[i] is the position that
+// element i of the source batch moved to, after adding an encryption of zero
+// with Factors[i]. Input→shadow factors lie in [0, 2^(RandomnessBits+SlackBits))
+// and shadow→output factors in (-2^(RandomnessBits+SlackBits), 0].
+type Opening struct {
+	Destination []int
+	Factors     []*big.Int
+}
+
+// Mix re-randomizes and permutes inputs and proves the shuffle was honest.
+// Randomness for the permutation, the factors and the proof is read from random.
+func Mix(pk *m1fp.PublicKey, inputs []*m1fp.Ciphertext, random io.Reader) (*Shuffle, error) {
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("empty batch")
+	}
+	n := len(inputs)
+
+	// The real shuffle uses small factors so the outputs keep decrypting.
+	perm, err := randomPermutation(n, random)
+	if err != nil {
+		return nil, err
+	}
+	factors := make([]*big.Int, n)
+	output := make([]*m1fp.Ciphertext, n)
+	for i, ct := range inputs {
+		out, s, err := m1fp.ReRandomizeWithFactor(pk, ct, random)
+		if err != nil {
+			return nil, err
+		}
+		factors[i] = s
+		output[perm[i]] = out
+	}
+
+	for {
+		proof, err := prove(pk, inputs, output, perm, factors, random)
+		if err != nil {
+			return nil, err
+		}
+		if proof != nil {
+			return &Shuffle{Output: output, Proof: proof}, nil
+		}
+	}
+}
+
+// prove makes one attempt at the shuffle proof of output = perm(inputs
+// re-randomized with factors). It returns a nil proof without error when a
+// revealed factor falls outside its accepted interval, which would leak the
+// real factor; that happens with probability about 2n · Rounds · 2^-SlackBits.
+func prove(pk *m1fp.PublicKey, inputs, output []*m1fp.Ciphertext, perm []int, factors []*big.Int, random io.Reader) (*Proof, error) {
+	n := len(inputs)
+	bound := factorBound()
+	tMax := new(big.Int).Add(bound, new(big.Int).Lsh(big.NewInt(1), m1fp.RandomnessBits))
+
+	// Shadow factors t are drawn from [0, bound + 2^RandomnessBits), so that
+	// the accepted values of t and of s - t are uniform whatever s is.
+	shadowPerms := make([][]int, Rounds)
+	shadowFactors := make([][]*big.Int, Rounds)
+	shadows := make([][]*m1fp.Ciphertext, Rounds)
+	for j := range Rounds {
+		var err error
+		if shadowPerms[j], err = randomPermutation(n, random); err != nil {
+			return nil, err
+		}
+		shadowFactors[j] = make([]*big.Int, n)
+		shadows[j] = make([]*m1fp.Ciphertext, n)
+		for i, ct := range inputs {
+			t, err := rand.Int(random, tMax)
+			if err != nil {
+				return nil, err
+			}
+			shadowFactors[j][i] = t
+			if shadows[j][shadowPerms[j][i]], err = m1fp.ReRandomizeDeterministic(pk, ct, t); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	bits := challenge(pk, inputs, output, shadows)
+	openings := make([]*Opening, Rounds)
+	for j := range Rounds {
+		if bits.Bit(j) == 0 {
+			for _, t := range shadowFactors[j] {
+				if t.Cmp(bound) >= 0 {
+					return nil, nil
+				}
+			}
+			openings[j] = &Opening{Destination: shadowPerms[j], Factors: shadowFactors[j]}
+			continue
+		}
+		// Open shadow→output: shadow element at σ(i) moves to π(i) with s_i - t_i.
+		o := &Opening{Destination: make([]int, n), Factors: make([]*big.Int, n)}
+		for i := range n {
+			k := shadowPerms[j][i]
+			o.Destination[k] = perm[i]
+			u := new(big.Int).Sub(factors[i], shadowFactors[j][i])
+			if u.Sign() > 0 || u.CmpAbs(bound) >= 0 {
+				return nil, nil
+			}
+			o.Factors[k] = u
+		}
+		openings[j] = o
+	}
+	return &Proof{Shadows: shadows, Openings: openings}, nil
+}
+
+// VerifyShuffle checks that s is an honest shuffle of inputs under pk, whose
+// outputs still decrypt if the inputs were encrypted with randomness below
+// 2^RandomnessBits.
+func VerifyShuffle(pk *m1fp.PublicKey, inputs []*m1fp.Ciphertext, s *Shuffle) error {
+	if err := checkNoise(pk, inputs, 1); err != nil {
+		return err
+	}
+	return verifyShuffle(pk, inputs, s)
+}
+
+// verifyShuffle is VerifyShuffle without the noise budget check.
+func verifyShuffle(pk *m1fp.PublicKey, inputs []*m1fp.Ciphertext, s *Shuffle) error {
+	if s == nil || s.Proof == nil {
+		return fmt.Errorf("missing shuffle proof")
+	}
+	n := len(inputs)
+	if n == 0 || len(s.Output) != n {
+		return fmt.Errorf("batch size mismatch: %d inputs, %d outputs", n, len(s.Output))
+	}
+	if len(s.Proof.Shadows) != Rounds || len(s.Proof.Openings) != Rounds {
+		return fmt.Errorf("shuffle proof must have %d rounds", Rounds)
+	}
+	if hasNil(inputs) || hasNil(s.Output) {
+		return fmt.Errorf("nil ciphertext in batch")
+	}
+	for j, shadow := range s.Proof.Shadows {
+		if len(shadow) != n || hasNil(shadow) {
+			return fmt.Errorf("round %d: malformed shadow batch", j)
+		}
+	}
+
+	bound := factorBound()
+	bits := challenge(pk, inputs, s.Output, s.Proof.Shadows)
+	for j := range Rounds {
+		from, to := inputs, s.Proof.Shadows[j]
+		lo, hi := big.NewInt(0), bound
+		if bits.Bit(j) == 1 {
+			from, to = s.Proof.Shadows[j], s.Output
+			lo, hi = new(big.Int).Sub(big.NewInt(1), bound), big.NewInt(1)
+		}
+		if err := checkOpening(pk, from, to, s.Proof.Openings[j], lo, hi); err != nil {
+			return fmt.Errorf("round %d: %w", j, err)
+		}
+	}
+	return nil
+}
+
+// VerifyCascade checks every shuffle of a cascade in order, each one taking
+// the previous output as input, and returns the final batch to be decrypted.
+// It fails if the cascade is long enough for the outputs to exceed the noise
+// budget of pk, given inputs encrypted with randomness below 2^RandomnessBits.
+func VerifyCascade(pk *m1fp.PublicKey, inputs []*m1fp.Ciphertext, shuffles []*Shuffle) ([]*m1fp.Ciphertext, error) {
+	if len(shuffles) == 0 {
+		return nil, fmt.Errorf("empty cascade")
+	}
+	if err := checkNoise(pk, inputs, len(shuffles)); err != nil {
+		return nil, err
+	}
+	cur := inputs
+	for i, s := range shuffles {
+		if err := verifyShuffle(pk, cur, s); err != nil {
+			return nil, fmt.Errorf("mix server %d: %w", i, err)
+		}
+		cur = s.Output
+	}
+	return cur, nil
+}
+
+// checkOpening verifies that to is from permuted by o.Destination and
+// re-randomized with o.Factors, each of which must lie in [lo, hi).
+func checkOpening(pk *m1fp.PublicKey, from, to []*m1fp.Ciphertext, o *Opening, lo, hi *big.Int) error {
+	n := len(from)
+	if o == nil || len(o.Destination) != n || len(o.Factors) != n {
+		return fmt.Errorf("malformed opening")
+	}
+	used := make([]bool, n)
+	for i, dst := range o.Destination {
+		if dst < 0 || dst >= n || used[dst] {
+			return fmt.Errorf("opening is not a permutation")
+		}
+		used[dst] = true
+
+		f := o.Factors[i]
+		if f == nil || f.Cmp(lo) < 0 || f.Cmp(hi) >= 0 {
+			return fmt.Errorf("factor %d out of bounds", i)
+		}
+		want, err := m1fp.ReRandomizeDeterministic(pk, from[i], o.Factors[i])
+		if err != nil {
+			return err
+		}
+		if !equal(want, to[dst]) {
+			return fmt.Errorf("element %d does not re-encrypt to position %d", i, dst)
+		}
+	}
+	return nil
+}
+
+// checkNoise checks that inputs encrypted with randomness below
+// 2^RandomnessBits still decrypt after the given number of verified
+// shuffles, each adding less than factorBound to their randomness.
+func checkNoise(pk *m1fp.PublicKey, inputs []*m1fp.Ciphertext, servers int) error {
+	total := new(big.Int).Mul(factorBound(), big.NewInt(int64(servers)))
+	total.Add(total, new(big.Int).Lsh(big.NewInt(1), m1fp.RandomnessBits))
+	for i, ct := range inputs {
+		if ct == nil {
+			continue
+		}
+		if budget := pk.NoiseBits(ct.GetDigitCount()); total.BitLen() > budget {
+			return fmt.Errorf("input %d: %d mix servers exceed the noise budget of %d-digit ciphertexts", i, servers, ct.GetDigitCount())
+		}
+	}
+	return nil
+}
+
+// factorBound returns 2^(RandomnessBits+SlackBits), the bound on the
+// absolute value of every revealed factor.
+func factorBound() *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), m1fp.RandomnessBits+SlackBits)
+}
+
+// challenge derives the Rounds challenge bits from the whole shuffle statement.
+func challenge(pk *m1fp.PublicKey, inputs, output []*m1fp.Ciphertext, shadows [][]*m1fp.Ciphertext) *big.Int {
+	t := transcript.New("m1fp/mixnet/shuffle")
+	t.AppendPublicKey("pk", pk.Prec, pk.N, pk.XInt, pk.HInt)
+	t.AppendUint64("size", uint64(len(inputs)))
+	for _, ct := range inputs {
+		t.AppendCiphertext("input", ct)
+	}
+	for _, ct := range output {
+		t.AppendCiphertext("output", ct)
+	}
+	for _, shadow := range shadows {
+		for _, ct := range shadow {
+			t.AppendCiphertext("shadow", ct)
+		}
+	}
+	return t.ChallengeBits("challenge", Rounds)
+}
+
+// randomPermutation returns a uniformly random permutation of [0, n).
+func randomPermutation(n int, random io.Reader) ([]int, error) {
+	p := make([]int, n)
+	for i := range p {
+		p[i] = i
+	}
+	for i := n - 1; i > 0; i-- {
+		j, err := rand.Int(random, big.NewInt(int64(i+1)))
+		if err != nil {
+			return nil, err
+		}
+		p[i], p[j.Int64()] = p[j.Int64()], p[i]
+	}
+	return p, nil
+}
+
+// equal reports whether two ciphertexts have identical components.
+func equal(a, b *m1fp.Ciphertext) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	return a.GetDigitCount() == b.GetDigitCount() &&
+		a.GetC1Int().Cmp(b.GetC1Int()) == 0 &&
+		a.GetC2Int().Cmp(b.GetC2Int()) == 0
+}
+
+// hasNil reports whether a batch contains a nil ciphertext.
+func hasNil(batch []*m1fp.Ciphertext) bool {
+	for _, ct := range batch {
+		if ct == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package mixnet
+
+import (
+	"crypto/rand"
+	"math/big"
+	"slices"
+	"testing"
+
+	"github.com/p4u/m1fp-go/m1fp"
+)
+
+func TestCascadeShufflesWriteIns(t *testing.T) {
+	sk, pk, err := m1fp.KeyGen(256, m1fp.X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	// Encrypt fits VoteDigits digits, i.e. three bytes of text per ciphertext.
+	writeIns := []string{"ann", "bob", "cy", "dee", "eve"}
+	inputs := make([]*m1fp.Ciphertext, len(writeIns))
+	for i, w := range writeIns {
+		if inputs[i], _, err = m1fp.Encrypt(pk, w); err != nil {
+			t.Fatalf("Encrypt failed: %v", err)
+		}
+	}
+
+	// Three mix servers in a cascade.
+	var shuffles []*Shuffle
+	cur := inputs
+	for range 3 {
+		s, err := Mix(pk, cur, rand.Reader)
+		if err != nil {
+			t.Fatalf("Mix failed: %v", err)
+		}
+		shuffles = append(shuffles, s)
+		cur = s.Output
+	}
+
+	final, err := VerifyCascade(pk, inputs, shuffles)
+	if err != nil {
+		t.Fatalf("honest cascade rejected: %v", err)
+	}
+
+	got := make([]string, len(final))
+	for i, ct := range final {
+		if got[i], err = m1fp.Decrypt(sk, ct); err != nil {
+			t.Fatalf("Decrypt failed: %v", err)
+		}
+	}
+	slices.Sort(got)
+	if !slices.Equal(got, writeIns) {
+		t.Fatalf("mixed plaintexts differ: got %v, want %v", got, writeIns)
+	}
+}
+
+func TestShuffleRejectsSubstitution(t *testing.T) {
+	_, pk, err := m1fp.KeyGen(256, m1fp.X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+
+	inputs := make([]*m1fp.Ciphertext, 4)
+	for i := range inputs {
+		if inputs[i], _, err = m1fp.EncryptVote(pk, uint64(i), nil); err != nil {
+			t.Fatalf("EncryptVote failed: %v", err)
+		}
+	}
+	s, err := Mix(pk, inputs, rand.Reader)
+	if err != nil {
+		t.Fatalf("Mix failed: %v", err)
+	}
+	if err := VerifyShuffle(pk, inputs, s); err != nil {
+		t.Fatalf("honest shuffle rejected: %v", err)
+	}
+
+	// A server replacing one ballot with its own encryption is caught.
+	forged, _, err := m1fp.EncryptVote(pk, 64, nil)
+	if err != nil {
+		t.Fatalf("EncryptVote failed: %v", err)
+	}
+	tampered := &Shuffle{Output: slices.Clone(s.Output), Proof: s.Proof}
+	tampered.Output[2] = forged
+	if err := VerifyShuffle(pk, inputs, tampered); err == nil {
+		t.Fatalf("substituted output accepted")
+	}
+
+	// A proof cannot be replayed against a different input batch.
+	other := slices.Clone(inputs)
+	other[0], other[1] = other[1], other[0]
+	if err := VerifyShuffle(pk, other, s); err == nil {
+		t.Fatalf("proof accepted for a different input batch")
+	}
+}
+
+// mixUnbounded is a malicious mix server that re-randomizes with factors
+// uniform in Z_D, and hides them behind shadow factors uniform in Z_D, so
+// every opening is consistent.
+func mixUnbounded(pk *m1fp.PublicKey, inputs []*m1fp.Ciphertext) (*Shuffle, error) {
+	n := len(inputs)
+	factors := make([]*big.Int, n)
+	output := make([]*m1fp.Ciphertext, n)
+	for i, ct := range inputs {
+		s, err := rand.Int(rand.Reader, pk.D)
+		if err != nil {
+			return nil, err
+		}
+		factors[i] = s
+		if output[i], err = m1fp.ReRandomizeDeterministic(pk, ct, s); err != nil {
+			return nil, err
+		}
+	}
+	shadowFactors := make([][]*big.Int, Rounds)
+	shadows := make([][]*m1fp.Ciphertext, Rounds)
+	for j := range Rounds {
+		shadowFactors[j] = make([]*big.Int, n)
+		shadows[j] = make([]*m1fp.Ciphertext, n)
+		for i, ct := range inputs {
+			t, err := rand.Int(rand.Reader, pk.D)
+			if err != nil {
+				return nil, err
+			}
+			shadowFactors[j][i] = t
+			if shadows[j][i], err = m1fp.ReRandomizeDeterministic(pk, ct, t); err != nil {
+				return nil, err
+			}
+		}
+	}
+	identity := make([]int, n)
+	for i := range identity {
+		identity[i] = i
+	}
+	bits := challenge(pk, inputs, output, shadows)
+	openings := make([]*Opening, Rounds)
+	for j := range Rounds {
+		o := &Opening{Destination: identity, Factors: shadowFactors[j]}
+		if bits.Bit(j) == 1 {
+			o = &Opening{Destination: identity, Factors: make([]*big.Int, n)}
+			for i := range n {
+				u := new(big.Int).Sub(factors[i], shadowFactors[j][i])
+				o.Factors[i] = u.Mod(u, pk.D)
+			}
+		}
+		openings[j] = o
+	}
+	return &Shuffle{Output: output, Proof: &Proof{Shadows: shadows, Openings: openings}}, nil
+}
+
+func TestShuffleRejectsLargeFactors(t *testing.T) {
+	sk, pk, err := m1fp.KeyGen(256, m1fp.X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+	inputs := make([]*m1fp.Ciphertext, 3)
+	for i := range inputs {
+		if inputs[i], _, err = m1fp.EncryptVote(pk, uint64(i+1), big.NewInt(int64(100+i))); err != nil {
+			t.Fatalf("EncryptVote failed: %v", err)
+		}
+	}
+
+	s, err := mixUnbounded(pk, inputs)
+	if err != nil {
+		t.Fatalf("mixUnbounded failed: %v", err)
+	}
+	if err := VerifyShuffle(pk, inputs, s); err == nil {
+		garbled := 0
+		for i, ct := range s.Output {
+			if v, _ := m1fp.DecryptVote(sk, ct); v != uint64(i+1) {
+				garbled++
+			}
+		}
+		t.Fatalf("shuffle with factors mod D accepted, %d of %d outputs garbled", garbled, len(inputs))
+	}
+
+	// Cascades long enough to exhaust the noise budget are refused even when
+	// every shuffle is honest.
+	servers := 1 << (pk.NoiseBits(m1fp.VoteDigits) - m1fp.RandomnessBits - SlackBits)
+	shuffles := make([]*Shuffle, servers)
+	if _, err := VerifyCascade(pk, inputs, shuffles); err == nil {
+		t.Fatalf("cascade of %d servers accepted", servers)
+	}
+}
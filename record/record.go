@@ -0,0 +1,341 @@
+// Package record writes and verifies the public record of an election: the
+// manifest, the census, every signed ballot envelope, the bulletin board
+// the counters were posted to, and the decrypted results with their proofs.
+// Anyone holding a copy of the record can rerun Verify, which checks every
+// ballot proof, recomputes the tallies from the board with AddMany and
+// checks the decryption proofs of the published results.
+package record
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/p4u/m1fp-go/board"
+	"github.com/p4u/m1fp-go/eligibility"
+	"github.com/p4u/m1fp-go/m1fp"
+	"github.com/p4u/m1fp-go/manifest"
+	"github.com/p4u/m1fp-go/merkle"
+)
+
+// Files of a record directory.
+const (
+	ManifestFile = "manifest.json" // Canonical manifest
+	CensusFile   = "census.json"   // Census root and size
+	BallotsFile  = "ballots.jsonl" // One envelope per line, in board order
+	BoardFile    = "board.log"     // Board log of the tally counters
+	HeadFile     = "board.json"    // Board key and final signed tree head
+	ResultsFile  = "results.json"  // Signed results document
+)
+
+// Census is the published commitment to the eligible voters.
+type Census struct {
+	Root merkle.Hash `json:"root"`
+	Size uint64      `json:"size"`
+}
+
+// Head is the final state of the bulletin board.
+type Head struct {
+	PublicKey ed25519.PublicKey `json:"public_key"`
+	Head      *board.TreeHead   `json:"head"`
+}
+
+// Recorder admits envelopes and writes the record of an election. Every
+// admitted envelope is appended to the ballots file and its counters, one
+// per result count of each question in manifest order, to the board, so
+// the board tally of a question is the sum of its counters. A Recorder is
+// safe for concurrent use.
+type Recorder struct {
+	mu      sync.Mutex
+	dir     string
+	m       *manifest.Manifest
+	gate    *eligibility.Gate
+	board   *board.Board
+	ballots *os.File
+	err     error // Set when the ballots file may not match the board
+}
+
+// Create starts the record of the election m in dir, which must not hold
+// another record; Open resumes an existing one. Tree heads of the board are
+// signed with boardKey.
+func Create(dir string, m *manifest.Manifest, census *eligibility.Census, boardKey ed25519.PrivateKey) (*Recorder, error) {
+	h, err := m.Hash()
+	if err != nil {
+		return nil, err
+	}
+	pk, err := m.Key()
+	if err != nil {
+		return nil, err
+	}
+	gate, err := eligibility.NewGate(m, census.Root(), census.Size())
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	ballots, err := os.OpenFile(filepath.Join(dir, BallotsFile), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	r := &Recorder{dir: dir, m: m, gate: gate, ballots: ballots}
+	canonical, err := m.Canonical()
+	if err == nil {
+		err = writeFile(filepath.Join(dir, ManifestFile), canonical)
+	}
+	if err == nil {
+		err = writeJSON(filepath.Join(dir, CensusFile), &Census{Root: census.Root(), Size: census.Size()})
+	}
+	if err == nil {
+		r.board, err = board.Open(filepath.Join(dir, BoardFile), h, pk, boardKey)
+	}
+	if err != nil {
+		ballots.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Open resumes the record in dir after a restart or a crash, signing new
+// tree heads with boardKey. Every envelope of the ballots file is verified
+// and admitted again, so the gate rejects the voters who already voted, and
+// its counters are checked against the board. Counters of an envelope that
+// reached the ballots file but not the board before a crash are posted now,
+// and a torn envelope at the end of the file, which was never cast, is
+// discarded. A finished record cannot be reopened.
+func Open(dir string, boardKey ed25519.PrivateKey) (*Recorder, error) {
+	if _, err := os.Stat(filepath.Join(dir, HeadFile)); err == nil {
+		return nil, fmt.Errorf("record is already finished")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	m, err := manifest.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	h, err := m.Hash()
+	if err != nil {
+		return nil, err
+	}
+	pk, err := m.Key()
+	if err != nil {
+		return nil, err
+	}
+	var census Census
+	if err := readJSON(filepath.Join(dir, CensusFile), &census); err != nil {
+		return nil, err
+	}
+	gate, err := eligibility.NewGate(m, census.Root, census.Size)
+	if err != nil {
+		return nil, err
+	}
+	b, err := board.Open(filepath.Join(dir, BoardFile), h, pk, boardKey)
+	if err != nil {
+		return nil, err
+	}
+	ballots, err := os.OpenFile(filepath.Join(dir, BallotsFile), os.O_RDWR, 0)
+	if err != nil {
+		b.Close()
+		return nil, err
+	}
+	r := &Recorder{dir: dir, m: m, gate: gate, board: b, ballots: ballots}
+	if err := r.replay(); err != nil {
+		ballots.Close()
+		b.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// replay admits the envelopes of the ballots file in order, matching their
+// counters with the board entries, and leaves the file positioned after the
+// last complete envelope.
+func (r *Recorder) replay() error {
+	var offset int64
+	var pos uint64
+	in := bufio.NewReader(r.ballots)
+	for i := 0; ; i++ {
+		line, err := in.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			break // A torn last line was never cast
+		}
+		if err != nil {
+			return err
+		}
+		var e eligibility.Envelope
+		if err := json.Unmarshal(line, &e); err != nil {
+			return fmt.Errorf("ballot %d: %w", i, err)
+		}
+		_, err = r.gate.AdmitFunc(&e, func(counters [][]*m1fp.Ciphertext) error {
+			cts := slices.Concat(counters...)
+			logged := min(r.board.Size()-pos, uint64(len(cts)))
+			for j := range logged {
+				ct, err := r.board.Entry(pos + j)
+				if err != nil || !sameCiphertext(cts[j], ct) {
+					return fmt.Errorf("counter %d is not on the board at entry %d", j, pos+j)
+				}
+			}
+			// A crash may have cut the board write of the last envelope.
+			if logged < uint64(len(cts)) {
+				if _, err := r.board.AppendAll(cts[logged:]); err != nil {
+					return err
+				}
+			}
+			pos += uint64(len(cts))
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("ballot %d: %w", i, err)
+		}
+		offset += int64(len(line))
+	}
+	if pos != r.board.Size() {
+		return fmt.Errorf("board holds %d entries, the ballots account for %d", r.board.Size(), pos)
+	}
+	if err := r.ballots.Truncate(offset); err != nil {
+		return err
+	}
+	_, err := r.ballots.Seek(offset, io.SeekStart)
+	return err
+}
+
+// Cast admits e and records it. The envelope is written to the ballots
+// file and its counters to the board before the gate admits its nullifier;
+// if either write fails, both are rolled back and the voter can cast again.
+// If the rollback itself fails the recorder refuses further ballots.
+func (r *Recorder) Cast(e *eligibility.Envelope) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = r.gate.AdmitFunc(e, func(counters [][]*m1fp.Ciphertext) error {
+		offset, err := r.ballots.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		if _, err = r.ballots.Write(append(line, '\n')); err == nil {
+			err = r.ballots.Sync()
+		}
+		if err == nil {
+			_, err = r.board.AppendAll(slices.Concat(counters...))
+		}
+		if err != nil {
+			r.rollback(offset)
+		}
+		return err
+	})
+	return err
+}
+
+// Close closes the files of the record without finishing it, so that it
+// can be resumed with Open.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return errors.Join(r.ballots.Close(), r.board.Close())
+}
+
+// rollback truncates the ballots file back to offset after a failed cast.
+func (r *Recorder) rollback(offset int64) {
+	err := r.ballots.Truncate(offset)
+	if err == nil {
+		_, err = r.ballots.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		r.err = fmt.Errorf("ballots file may hold an unrecorded envelope: %w", err)
+	}
+}
+
+// Finish publishes the final tree head, decrypts every tally with the
+// election key held by trustee and publishes the results with their
+// decryption proofs, signed with the trustee key signer. Proof randomness
+// is read from random. The recorder is closed afterwards.
+func (r *Recorder) Finish(sk *m1fp.PrivateKey, trustee string, signer ed25519.PrivateKey, random io.Reader) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.ballots.Close()
+	defer r.board.Close()
+
+	th, err := r.board.TreeHead()
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(filepath.Join(r.dir, HeadFile), &Head{PublicKey: r.board.PublicKey(), Head: th}); err != nil {
+		return err
+	}
+
+	results := &Results{Manifest: th.Manifest, BoardSize: th.Size, BoardRoot: th.Root, Trustee: trustee}
+	for _, q := range r.m.Questions {
+		tv, err := r.gate.Tally(q.ID)
+		if err != nil {
+			return err
+		}
+		t := &Tally{
+			Result:    manifest.Result{ManifestHash: th.Manifest, QuestionID: q.ID, Counts: make([]uint64, len(tv.Entries))},
+			Aggregate: tv.Entries,
+			Proofs:    make([]*m1fp.DecryptionProof, len(tv.Entries)),
+		}
+		for i, ct := range tv.Entries {
+			if ct == nil {
+				continue
+			}
+			if t.Counts[i], t.Proofs[i], err = m1fp.ProveDecryption(sk, ct, random); err != nil {
+				return fmt.Errorf("question %q: count %d: %w", q.ID, i, err)
+			}
+		}
+		results.Tallies = append(results.Tallies, t)
+	}
+	if err := results.Sign(signer); err != nil {
+		return err
+	}
+	return writeJSON(filepath.Join(r.dir, ResultsFile), results)
+}
+
+// writeJSON writes v to path as indented JSON with writeFile.
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(path, append(data, '\n'))
+}
+
+// writeFile replaces path with data atomically through a synced temporary
+// file in the same directory.
+func writeFile(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,404 @@
+package record
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/p4u/m1fp-go/board"
+	"github.com/p4u/m1fp-go/eligibility"
+	"github.com/p4u/m1fp-go/m1fp"
+	"github.com/p4u/m1fp-go/manifest"
+	"github.com/p4u/m1fp-go/merkle"
+)
+
+// testRecord is an election with three eligible voters whose record is
+// being written.
+type testRecord struct {
+	dir        string
+	m          *manifest.Manifest
+	h          manifest.Hash
+	sk         *m1fp.PrivateKey
+	pk         *m1fp.PublicKey
+	trusteeKey ed25519.PrivateKey
+	boardKey   ed25519.PrivateKey
+	keys       []ed25519.PrivateKey
+	pubs       []ed25519.PublicKey
+	census     *eligibility.Census
+	rec        *Recorder
+}
+
+// startRecord creates the record of a new election with three eligible
+// voters.
+func startRecord(t *testing.T) *testRecord {
+	t.Helper()
+	sk, pk, err := m1fp.KeyGen(256, m1fp.X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+	pkBytes, _ := pk.MarshalBinary()
+	trustee, trusteeKey, _ := ed25519.GenerateKey(rand.Reader)
+	m := &manifest.Manifest{
+		Version:    manifest.Version,
+		ElectionID: "assembly",
+		Parameters: manifest.DefaultParameters(),
+		PublicKey:  pkBytes,
+		Trustees:   []manifest.Trustee{{ID: "t", PublicKey: trustee}},
+		Questions: []manifest.Question{
+			{ID: "motion", Options: []string{"yes", "no", "abstain"}, Mode: m1fp.ModePlurality},
+			{ID: "order", Options: []string{"a", "b", "c"}, Mode: manifest.ModeBorda},
+		},
+	}
+	h, err := m.Hash()
+	if err != nil {
+		t.Fatalf("Hash failed: %v", err)
+	}
+
+	keys := make([]ed25519.PrivateKey, 3)
+	pubs := make([]ed25519.PublicKey, 3)
+	for i := range keys {
+		pubs[i], keys[i], _ = ed25519.GenerateKey(rand.Reader)
+	}
+	census, err := eligibility.NewCensus(pubs)
+	if err != nil {
+		t.Fatalf("NewCensus failed: %v", err)
+	}
+	_, boardKey, _ := ed25519.GenerateKey(rand.Reader)
+	dir := t.TempDir()
+	rec, err := Create(dir, m, census, boardKey)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	return &testRecord{
+		dir: dir, m: m, h: h, sk: sk, pk: pk, trusteeKey: trusteeKey, boardKey: boardKey,
+		keys: keys, pubs: pubs, census: census, rec: rec,
+	}
+}
+
+// seal returns the envelope of voter i choosing one motion option and
+// ranking the order options.
+func (tr *testRecord) seal(t *testing.T, i, choice int, ranking []int) *eligibility.Envelope {
+	t.Helper()
+	motion, _ := tr.m.Question("motion")
+	order, _ := tr.m.Question("order")
+	n := eligibility.NullifierOf(tr.h, tr.pubs[i])
+	spec, _ := eligibility.Spec(tr.h, motion, n)
+	values := make([]uint64, 3)
+	values[choice] = 1
+	b, err := spec.Encrypt(tr.pk, values, rand.Reader)
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	rb, err := m1fp.EncryptBorda(tr.pk, ranking, eligibility.Context(tr.h, order, n), rand.Reader)
+	if err != nil {
+		t.Fatalf("EncryptBorda failed: %v", err)
+	}
+	proof, _ := tr.census.Prove(tr.pubs[i])
+	answers := []eligibility.Answer{{QuestionID: "motion", Ballot: b}, {QuestionID: "order", Borda: rb}}
+	e, err := eligibility.Seal(tr.keys[i], tr.h, answers, proof)
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	return e
+}
+
+// writeRecord runs an election with three eligible voters, two of whom vote,
+// and returns the record directory, the manifest and the trustee key.
+func writeRecord(t *testing.T) (string, *manifest.Manifest, ed25519.PrivateKey) {
+	t.Helper()
+	tr := startRecord(t)
+	for i, vote := range []struct {
+		choice  int
+		ranking []int
+	}{{0, []int{0, 1, 2}}, {1, []int{2, 0, 1}}} {
+		e := tr.seal(t, i, vote.choice, vote.ranking)
+		if err := tr.rec.Cast(e); err != nil {
+			t.Fatalf("Cast failed: %v", err)
+		}
+		if err := tr.rec.Cast(e); err == nil {
+			t.Fatalf("double vote recorded")
+		}
+	}
+	if err := tr.rec.Finish(tr.sk, "t", tr.trusteeKey, rand.Reader); err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+	return tr.dir, tr.m, tr.trusteeKey
+}
+
+// readResults parses the results document of the record in dir.
+func readResults(t *testing.T, dir string) *Results {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, ResultsFile))
+	if err != nil {
+		t.Fatalf("reading results failed: %v", err)
+	}
+	r, err := ParseResults(data)
+	if err != nil {
+		t.Fatalf("ParseResults failed: %v", err)
+	}
+	return r
+}
+
+func TestVerifyElection(t *testing.T) {
+	dir, _, _ := writeRecord(t)
+
+	rep, err := Verify(dir)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if !rep.OK() || rep.Ballots != 2 || rep.Entries != 12 {
+		t.Fatalf("honest record: %d ballots, %d entries, findings %v", rep.Ballots, rep.Entries, rep.Findings)
+	}
+
+	results := readResults(t, dir)
+	if got := results.Tallies[0].Counts; !slices.Equal(got, []uint64{1, 1, 0}) {
+		t.Fatalf("motion counts %v, want [1 1 0]", got)
+	}
+	if got := results.Tallies[1].Counts; !slices.Equal(got, []uint64{3, 1, 2}) {
+		t.Fatalf("order scores %v, want [3 1 2]", got)
+	}
+}
+
+func TestVerifyElectionReportsDiscrepancies(t *testing.T) {
+	dir, _, trusteeKey := writeRecord(t)
+
+	// The trustee claims one more vote for "yes" and signs it.
+	results := readResults(t, dir)
+	results.Tallies[0].Counts[0]++
+	if err := results.Sign(trusteeKey); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if err := writeJSON(filepath.Join(dir, ResultsFile), results); err != nil {
+		t.Fatalf("writing results failed: %v", err)
+	}
+
+	// The second envelope loses its voter signature.
+	path := filepath.Join(dir, BallotsFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading ballots failed: %v", err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	var e eligibility.Envelope
+	if err := json.Unmarshal(lines[1], &e); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	e.Signature[0] ^= 1
+	lines[1], _ = json.Marshal(&e)
+	if err := os.WriteFile(path, append(bytes.Join(lines, []byte("\n")), '\n'), 0o644); err != nil {
+		t.Fatalf("writing ballots failed: %v", err)
+	}
+
+	rep, err := Verify(dir)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	var scopes []string
+	for _, f := range rep.Findings {
+		scopes = append(scopes, f.Scope)
+	}
+	if !slices.Equal(scopes, []string{"ballot 1", "trustee t"}) {
+		t.Fatalf("findings %v, want one for ballot 1 and one for trustee t", rep.Findings)
+	}
+	if !strings.Contains(rep.Findings[0].Problem, "signature") {
+		t.Fatalf("ballot finding %q does not mention the signature", rep.Findings[0].Problem)
+	}
+}
+
+func TestResultsDocument(t *testing.T) {
+	dir, m, trusteeKey := writeRecord(t)
+	results := readResults(t, dir)
+	if err := results.Verify(m); err != nil {
+		t.Fatalf("published results rejected: %v", err)
+	}
+
+	// The signature covers the canonical encoding, not the formatting.
+	canonical, err := results.Canonical()
+	if err != nil {
+		t.Fatalf("Canonical failed: %v", err)
+	}
+	compact, err := json.Marshal(results)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	reparsed, err := ParseResults(compact)
+	if err != nil {
+		t.Fatalf("ParseResults failed: %v", err)
+	}
+	if again, _ := reparsed.Canonical(); !bytes.Equal(again, canonical) {
+		t.Fatalf("canonical encoding changed across a round trip")
+	}
+	if err := reparsed.Verify(m); err != nil {
+		t.Fatalf("reformatted results rejected: %v", err)
+	}
+
+	results.BoardSize--
+	if err := results.Verify(m); err == nil {
+		t.Fatalf("results with an altered board size accepted")
+	}
+	results.BoardSize++
+
+	// A signed but false count fails its decryption proof.
+	results.Tallies[1].Counts[2]++
+	if err := results.Sign(trusteeKey); err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if err := results.Verify(m); err == nil {
+		t.Fatalf("results with a false count accepted")
+	}
+
+	_, outsider, _ := ed25519.GenerateKey(rand.Reader)
+	results.Tallies[1].Counts[2]--
+	results.Sign(outsider)
+	if err := results.Verify(m); err == nil {
+		t.Fatalf("results signed by an outsider accepted")
+	}
+}
+
+func TestResultsCanonicalKnownAnswer(t *testing.T) {
+	var h manifest.Hash
+	var root merkle.Hash
+	for i := range h {
+		h[i], root[i] = 0x11, 0x22
+	}
+	results := &Results{
+		Manifest:  h,
+		BoardSize: 2,
+		BoardRoot: root,
+		Trustee:   "t1",
+		Tallies: []*Tally{{
+			Result: manifest.Result{ManifestHash: h, QuestionID: "q1", Counts: []uint64{0, 2}},
+		}},
+		Signature: []byte{1, 2, 3},
+	}
+	want := `{"board_root":"` + root.String() + `","board_size":2,"manifest":"` + h.String() + `",` +
+		`"tallies":[{"aggregate":null,"counts":[0,2],"manifest_hash":"` + h.String() + `","proofs":null,"question_id":"q1"}],` +
+		`"trustee":"t1"}`
+	got, err := results.Canonical()
+	if err != nil {
+		t.Fatalf("Canonical failed: %v", err)
+	}
+	if string(got) != want {
+		t.Fatalf("canonical encoding\n got %s\nwant %s", got, want)
+	}
+	if results.Signature == nil {
+		t.Fatalf("Canonical cleared the signature")
+	}
+}
+
+func TestCastRollsBackFailedWrites(t *testing.T) {
+	tr := startRecord(t)
+	e := tr.seal(t, 0, 1, []int{1, 2, 0})
+
+	// The ballots file cannot be written: nothing reaches the board.
+	ballots := tr.rec.ballots
+	closed, err := os.Open(filepath.Join(tr.dir, BallotsFile))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	closed.Close()
+	tr.rec.ballots = closed
+	if err := tr.rec.Cast(e); err == nil {
+		t.Fatalf("Cast succeeded without a ballots file")
+	}
+	tr.rec.ballots = ballots
+	if n := tr.rec.board.Size(); n != 0 {
+		t.Fatalf("board holds %d entries after a failed cast", n)
+	}
+
+	// The board cannot be written: the envelope is removed from the ballots
+	// file again.
+	boardPath := filepath.Join(tr.dir, BoardFile)
+	tr.rec.board.Close()
+	if err := tr.rec.Cast(e); err == nil {
+		t.Fatalf("Cast succeeded without a board")
+	}
+	if info, err := os.Stat(filepath.Join(tr.dir, BallotsFile)); err != nil || info.Size() != 0 {
+		t.Fatalf("ballots file not rolled back: %v", err)
+	}
+	if tr.rec.board, err = board.Open(boardPath, tr.h, tr.pk, tr.boardKey); err != nil {
+		t.Fatalf("board.Open failed: %v", err)
+	}
+
+	// The voter was not locked out, and the record stays consistent.
+	if err := tr.rec.Cast(e); err != nil {
+		t.Fatalf("Cast after failures: %v", err)
+	}
+	if err := tr.rec.Finish(tr.sk, "t", tr.trusteeKey, rand.Reader); err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+	rep, err := Verify(tr.dir)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if !rep.OK() || rep.Ballots != 1 || rep.Entries != 6 {
+		t.Fatalf("record after failures: %d ballots, %d entries, findings %v", rep.Ballots, rep.Entries, rep.Findings)
+	}
+}
+
+func TestOpenResumesAfterCrash(t *testing.T) {
+	tr := startRecord(t)
+	if err := tr.rec.Cast(tr.seal(t, 0, 0, []int{0, 1, 2})); err != nil {
+		t.Fatalf("Cast failed: %v", err)
+	}
+	if err := tr.rec.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// The process dies after syncing the envelope of voter 1 and before its
+	// counters reach the board, then again while writing that of voter 2.
+	line := func(e *eligibility.Envelope) []byte {
+		data, err := json.Marshal(e)
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		return append(data, '\n')
+	}
+	torn := line(tr.seal(t, 2, 2, []int{1, 0, 2}))
+	f, err := os.OpenFile(filepath.Join(tr.dir, BallotsFile), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	f.Write(line(tr.seal(t, 1, 1, []int{2, 0, 1})))
+	f.Write(torn[:len(torn)/2])
+	f.Close()
+
+	rec, err := Open(tr.dir, tr.boardKey)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if n := rec.board.Size(); n != 12 {
+		t.Fatalf("board holds %d entries after reopening, want 12", n)
+	}
+	if err := rec.Cast(tr.seal(t, 0, 1, []int{2, 1, 0})); err == nil {
+		t.Fatalf("double vote recorded after reopening")
+	}
+	if err := rec.Cast(tr.seal(t, 2, 2, []int{1, 0, 2})); err != nil {
+		t.Fatalf("Cast of the torn voter failed: %v", err)
+	}
+	if err := rec.Finish(tr.sk, "t", tr.trusteeKey, rand.Reader); err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+	if _, err := Open(tr.dir, tr.boardKey); err == nil {
+		t.Fatalf("finished record reopened")
+	}
+
+	rep, err := Verify(tr.dir)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if !rep.OK() || rep.Ballots != 3 || rep.Entries != 18 {
+		t.Fatalf("resumed record: %d ballots, %d entries, findings %v", rep.Ballots, rep.Entries, rep.Findings)
+	}
+	for _, tally := range readResults(t, tr.dir).Tallies {
+		if tally.QuestionID == "motion" && !slices.Equal(tally.Counts, []uint64{1, 1, 1}) {
+			t.Fatalf("motion counts %v, want [1 1 1]", tally.Counts)
+		}
+	}
+}
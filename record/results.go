@@ -0,0 +1,165 @@
+package record
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/p4u/m1fp-go/canonical"
+	"github.com/p4u/m1fp-go/m1fp"
+	"github.com/p4u/m1fp-go/manifest"
+	"github.com/p4u/m1fp-go/merkle"
+)
+
+// resultsDomain separates results signatures from other Ed25519 messages.
+const resultsDomain = "m1fp/record/results"
+
+// Tally is the decrypted result of one question, with the aggregate
+// ciphertext of every count and the proof that it decrypts to that count.
+// Counts of options nobody voted for have neither aggregate nor proof.
+type Tally struct {
+	manifest.Result
+	Aggregate []*m1fp.Ciphertext      `json:"aggregate"`
+	Proofs    []*m1fp.DecryptionProof `json:"proofs"`
+}
+
+// Results is the published outcome of an election: one tally per question,
+// in manifest order, computed over the board of the given size and root and
+// signed by the trustee that decrypted them.
+type Results struct {
+	Manifest  manifest.Hash `json:"manifest"`
+	BoardSize uint64        `json:"board_size"`
+	BoardRoot merkle.Hash   `json:"board_root"`
+	Trustee   string        `json:"trustee"`
+	Tallies   []*Tally      `json:"tallies"`
+	Signature []byte        `json:"signature,omitempty"` // Ed25519 signature of the trustee
+}
+
+// ParseResults decodes a JSON results document. Unknown fields are
+// rejected, so that everything a verifier reads is covered by the signature.
+func ParseResults(data []byte) (*Results, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	r := new(Results)
+	if err := dec.Decode(r); err != nil {
+		return nil, fmt.Errorf("results: %w", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("results: trailing data")
+	}
+	return r, nil
+}
+
+// Canonical returns the canonical encoding of the results without their
+// signature: their JSON encoding in RFC 8785 canonical form, as for
+// manifests. This is what the trustee signs.
+func (r *Results) Canonical() ([]byte, error) {
+	unsigned := *r
+	unsigned.Signature = nil
+	return canonical.Marshal(&unsigned)
+}
+
+// Sign signs the results with the Ed25519 key of their trustee.
+func (r *Results) Sign(key ed25519.PrivateKey) error {
+	if len(key) != ed25519.PrivateKeySize {
+		return fmt.Errorf("invalid trustee signing key")
+	}
+	msg, err := r.message()
+	if err != nil {
+		return err
+	}
+	r.Signature = ed25519.Sign(key, msg)
+	return nil
+}
+
+// Verify checks that the results belong to the election m, are signed by
+// one of its trustees and that every count is proven to be the decryption
+// of its aggregate. It does not check that the aggregates are the tally of
+// the board; Verify of a whole record does.
+func (r *Results) Verify(m *manifest.Manifest) error {
+	if err := r.verifySignature(m); err != nil {
+		return err
+	}
+	pk, err := m.Key()
+	if err != nil {
+		return err
+	}
+	if len(r.Tallies) != len(m.Questions) {
+		return fmt.Errorf("results cover %d questions, manifest has %d", len(r.Tallies), len(m.Questions))
+	}
+	for i, t := range r.Tallies {
+		if err := t.check(m, &m.Questions[i]); err != nil {
+			return err
+		}
+		for j, ct := range t.Aggregate {
+			if ct == nil {
+				continue
+			}
+			if err := m1fp.VerifyDecryption(pk, ct, t.Counts[j], t.Proofs[j]); err != nil {
+				return fmt.Errorf("question %q: count %d: %w", t.QuestionID, j, err)
+			}
+		}
+	}
+	return nil
+}
+
+// verifySignature checks that the results commit to m and carry a valid
+// signature of their trustee.
+func (r *Results) verifySignature(m *manifest.Manifest) error {
+	h, err := m.Hash()
+	if err != nil {
+		return err
+	}
+	if r.Manifest != h {
+		return fmt.Errorf("results belong to another election")
+	}
+	var pub ed25519.PublicKey
+	for _, t := range m.Trustees {
+		if t.ID == r.Trustee {
+			pub = t.PublicKey
+		}
+	}
+	if pub == nil {
+		return fmt.Errorf("trustee %q is not in the manifest", r.Trustee)
+	}
+	msg, err := r.message()
+	if err != nil {
+		return err
+	}
+	if len(pub) != ed25519.PublicKeySize || !ed25519.Verify(pub, msg, r.Signature) {
+		return fmt.Errorf("invalid results signature")
+	}
+	return nil
+}
+
+// check checks that t is a well-formed result of question q: one count,
+// aggregate and proof per result count, and no count without an aggregate.
+func (t *Tally) check(m *manifest.Manifest, q *manifest.Question) error {
+	if t == nil || t.QuestionID != q.ID {
+		return fmt.Errorf("question %q: missing result", q.ID)
+	}
+	if err := m.CheckResult(&t.Result); err != nil {
+		return err
+	}
+	if len(t.Aggregate) != len(t.Counts) || len(t.Proofs) != len(t.Counts) {
+		return fmt.Errorf("question %q: result must have %d aggregates and proofs", q.ID, len(t.Counts))
+	}
+	for j, ct := range t.Aggregate {
+		if ct == nil && (t.Counts[j] != 0 || t.Proofs[j] != nil) {
+			return fmt.Errorf("question %q: count %d has no aggregate", q.ID, j)
+		}
+	}
+	return nil
+}
+
+// message returns the bytes covered by the trustee signature:
+// domain || canonical encoding.
+func (r *Results) message() ([]byte, error) {
+	data, err := r.Canonical()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(resultsDomain), data...), nil
+}
@@ -0,0 +1,258 @@
+package record
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/p4u/m1fp-go/board"
+	"github.com/p4u/m1fp-go/eligibility"
+	"github.com/p4u/m1fp-go/m1fp"
+	"github.com/p4u/m1fp-go/manifest"
+	"github.com/p4u/m1fp-go/merkle"
+)
+
+// Finding is one discrepancy found in a record. Scope names what it is
+// about: "ballot N" (0-based line of the ballots file), "board",
+// "question ID" or "trustee ID".
+type Finding struct {
+	Scope   string `json:"scope"`
+	Problem string `json:"problem"`
+}
+
+func (f Finding) String() string {
+	return f.Scope + ": " + f.Problem
+}
+
+// Report is the outcome of Verify.
+type Report struct {
+	Manifest manifest.Hash `json:"manifest"`
+	Ballots  int           `json:"ballots"` // Envelopes read
+	Entries  uint64        `json:"entries"` // Board entries read
+	Findings []Finding     `json:"findings"`
+}
+
+// OK reports whether the record verified without findings.
+func (r *Report) OK() bool {
+	return len(r.Findings) == 0
+}
+
+func (r *Report) addf(scope, format string, args ...any) {
+	r.Findings = append(r.Findings, Finding{Scope: scope, Problem: fmt.Sprintf(format, args...)})
+}
+
+// Verify checks the record in dir. Discrepancies are collected in the
+// report; the error is reserved for records that cannot be read at all,
+// such as a missing file or an invalid manifest.
+func Verify(dir string) (*Report, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
+	m, err := manifest.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	h, err := m.Hash()
+	if err != nil {
+		return nil, err
+	}
+	pk, err := m.Key()
+	if err != nil {
+		return nil, err
+	}
+	var census Census
+	if err := readJSON(filepath.Join(dir, CensusFile), &census); err != nil {
+		return nil, err
+	}
+	var head Head
+	if err := readJSON(filepath.Join(dir, HeadFile), &head); err != nil {
+		return nil, err
+	}
+	data, err = os.ReadFile(filepath.Join(dir, ResultsFile))
+	if err != nil {
+		return nil, err
+	}
+	results, err := ParseResults(data)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := board.ReadLog(filepath.Join(dir, BoardFile))
+	if err != nil {
+		return nil, err
+	}
+	gate, err := eligibility.NewGate(m, census.Root, census.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &Report{Manifest: h, Entries: uint64(len(entries))}
+	tree := checkBoard(rep, h, &head, entries)
+	if err := checkBallots(rep, m, gate, filepath.Join(dir, BallotsFile), entries); err != nil {
+		return nil, err
+	}
+	checkResults(rep, m, pk, results, tree, entries)
+	return rep, nil
+}
+
+// checkBoard checks that the signed tree head commits to the board log,
+// and returns the tree of the log.
+func checkBoard(rep *Report, h manifest.Hash, head *Head, entries []*m1fp.Ciphertext) *merkle.Tree {
+	tree := new(merkle.Tree)
+	for _, ct := range entries {
+		data, _ := ct.MarshalBinary()
+		tree.Append(data)
+	}
+	if err := board.VerifyTreeHead(head.PublicKey, head.Head); err != nil {
+		rep.addf("board", "%v", err)
+		return tree
+	}
+	if head.Head.Manifest != h {
+		rep.addf("board", "tree head belongs to another election")
+	}
+	if head.Head.Size != tree.Size() || head.Head.Root != tree.Root() {
+		rep.addf("board", "tree head (size %d, root %s) does not match the log (size %d, root %s)",
+			head.Head.Size, head.Head.Root, tree.Size(), tree.Root())
+	}
+	return tree
+}
+
+// checkBallots verifies every envelope and checks that its counters are the
+// board entries at its position. Each envelope accounts for stride entries.
+func checkBallots(rep *Report, m *manifest.Manifest, gate *eligibility.Gate, path string, entries []*m1fp.Ciphertext) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stride := 0
+	for i := range m.Questions {
+		stride += m.Questions[i].ResultSize()
+	}
+	seen := make(map[eligibility.Nullifier]int)
+	dec := json.NewDecoder(f)
+	for i := 0; ; i++ {
+		scope := fmt.Sprintf("ballot %d", i)
+		var e eligibility.Envelope
+		if err := dec.Decode(&e); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			rep.addf(scope, "unreadable envelope: %v", err)
+			break
+		}
+		rep.Ballots++
+		if first, ok := seen[e.Nullifier]; ok {
+			rep.addf(scope, "double vote, voter already voted in ballot %d", first)
+		} else {
+			seen[e.Nullifier] = i
+		}
+
+		counters, err := gate.Verify(&e)
+		if err != nil {
+			rep.addf(scope, "%v", err)
+			continue
+		}
+		pos := i * stride
+		for q, cts := range counters {
+			for j, ct := range cts {
+				if pos >= len(entries) || !sameCiphertext(ct, entries[pos]) {
+					rep.addf(scope, "question %q: count %d is not on the board at entry %d", m.Questions[q].ID, j, pos)
+				}
+				pos++
+			}
+		}
+	}
+	if want := uint64(rep.Ballots * stride); rep.Entries != want {
+		rep.addf("board", "log has %d entries, %d ballots account for %d", rep.Entries, rep.Ballots, want)
+	}
+	return nil
+}
+
+// checkResults checks the signature of the results, recomputes every tally
+// from the board with AddMany and checks the published aggregates, counts
+// and decryption proofs.
+func checkResults(rep *Report, m *manifest.Manifest, pk *m1fp.PublicKey, results *Results, tree *merkle.Tree, entries []*m1fp.Ciphertext) {
+	trustee := "trustee " + results.Trustee
+	if err := results.verifySignature(m); err != nil {
+		rep.addf(trustee, "%v", err)
+	}
+	if results.BoardSize != tree.Size() || results.BoardRoot != tree.Root() {
+		rep.addf(trustee, "results computed over board (size %d, root %s), log has size %d, root %s",
+			results.BoardSize, results.BoardRoot, tree.Size(), tree.Root())
+	}
+	if len(results.Tallies) != len(m.Questions) {
+		rep.addf(trustee, "results cover %d questions, manifest has %d", len(results.Tallies), len(m.Questions))
+		return
+	}
+
+	stride := 0
+	for i := range m.Questions {
+		stride += m.Questions[i].ResultSize()
+	}
+	offset := 0
+	for qi := range m.Questions {
+		q := &m.Questions[qi]
+		t := results.Tallies[qi]
+		if err := t.check(m, q); err != nil {
+			rep.addf(trustee, "%v", err)
+		} else {
+			checkTally(rep, trustee, pk, t, entries, offset, stride)
+		}
+		offset += q.ResultSize()
+	}
+}
+
+// checkTally checks the result of one question, whose counters sit at
+// offset within every stride entries of the board.
+func checkTally(rep *Report, trustee string, pk *m1fp.PublicKey, t *Tally, entries []*m1fp.Ciphertext, offset, stride int) {
+	scope := "question " + t.QuestionID
+	for j := range t.Counts {
+		var cts []*m1fp.Ciphertext
+		for pos := offset + j; pos < len(entries); pos += stride {
+			cts = append(cts, entries[pos])
+		}
+		if len(cts) == 0 {
+			if t.Aggregate[j] != nil || t.Counts[j] != 0 {
+				rep.addf(scope, "count %d: nothing on the board, result claims %d", j, t.Counts[j])
+			}
+			continue
+		}
+		sum, err := m1fp.AddMany(pk.Prec, cts...)
+		if err != nil {
+			rep.addf(scope, "count %d: %v", j, err)
+			continue
+		}
+		if t.Aggregate[j] == nil || !sameCiphertext(sum, t.Aggregate[j]) {
+			rep.addf(scope, "count %d: aggregate does not match the board tally", j)
+			continue
+		}
+		if err := m1fp.VerifyDecryption(pk, sum, t.Counts[j], t.Proofs[j]); err != nil {
+			rep.addf(trustee, "question %q: count %d: %v", t.QuestionID, j, err)
+		}
+	}
+}
+
+// sameCiphertext reports whether a and b have the same serialization.
+func sameCiphertext(a, b *m1fp.Ciphertext) bool {
+	da, errA := a.MarshalBinary()
+	db, errB := b.MarshalBinary()
+	return errA == nil && errB == nil && bytes.Equal(da, db)
+}
+
+// readJSON decodes the JSON file at path into v.
+func readJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
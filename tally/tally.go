@@ -0,0 +1,399 @@
+// Package tally keeps a running encrypted tally that survives crashes.
+//
+// Every accepted ciphertext is appended to a write-ahead log and synced
+// before Add returns, so an accepted ballot is never lost. Concurrent calls
+// share syncs: one caller syncs the log for every record written so far
+// while the others wait, so throughput does not stop at one fsync per
+// ballot. Every few thousand ballots the aggregate ciphertext is written to
+// a snapshot file together with the ballot count and the log position it
+// covers. On restart Open loads the snapshot and replays only the log
+// records past that position, so every ballot is counted exactly once.
+package tally
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/p4u/m1fp-go/m1fp"
+)
+
+// Files kept in the tally directory.
+const (
+	logFile      = "tally.wal"  // Write-ahead log of accepted ciphertexts
+	snapshotFile = "tally.snap" // Latest snapshot, replaced atomically
+)
+
+// DefaultSnapshotEvery is the number of ballots between snapshots used when
+// Open is given zero.
+const DefaultSnapshotEvery = 10000
+
+// maxRecord bounds the size of a single log record, well above the size of
+// an encoded vote ciphertext. A longer length field is corruption.
+const maxRecord = 1 << 12
+
+// castagnoli is the CRC-32C table of the log record checksums.
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// snapshot is the persisted state of an Accumulator: the sum of the first
+// Ballots ciphertexts of the log, which end at byte Offset.
+type snapshot struct {
+	Ballots uint64           `json:"ballots"`
+	Offset  int64            `json:"offset"`
+	Sum     *m1fp.Ciphertext `json:"sum,omitempty"`
+}
+
+// Accumulator is a durable running tally of vote ciphertexts. It is safe
+// for concurrent use.
+type Accumulator struct {
+	mu      sync.Mutex
+	syncMu  sync.Mutex // Held by the caller syncing the log
+	dir     string
+	pk      *m1fp.PublicKey
+	every   uint64
+	f       *os.File
+	err     error // Set when the log may no longer match memory
+	snapErr error // Error of the last automatic snapshot, if it failed
+
+	base   snapshot    // Latest snapshot written or loaded
+	live   *m1fp.Tally // Ciphertexts logged after base.Offset
+	offset int64       // End of the last log record written
+	synced int64       // End of the last durable log record
+}
+
+// Open opens or creates the tally kept in dir for ciphertexts under pk,
+// snapshotting every snapshotEvery ballots (DefaultSnapshotEvery if zero).
+// It recovers the tally from the latest snapshot and the log records after
+// it. A torn record left by a crash, which runs to the end of the log, is
+// discarded; any other damaged record makes Open fail and leaves the log
+// untouched, since the records after it hold durable ballots.
+func Open(dir string, pk *m1fp.PublicKey, snapshotEvery int) (*Accumulator, error) {
+	if snapshotEvery < 0 {
+		return nil, fmt.Errorf("negative snapshot interval")
+	}
+	if snapshotEvery == 0 {
+		snapshotEvery = DefaultSnapshotEvery
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	a := &Accumulator{dir: dir, pk: pk, every: uint64(snapshotEvery), live: m1fp.NewTally(pk)}
+
+	data, err := os.ReadFile(filepath.Join(dir, snapshotFile))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, &a.base); err != nil {
+			return nil, fmt.Errorf("tally snapshot: %w", err)
+		}
+		if (a.base.Sum == nil) != (a.base.Ballots == 0) || a.base.Offset < 0 {
+			return nil, fmt.Errorf("tally snapshot: inconsistent state")
+		}
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, logFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	a.f = f
+	if err := a.recover(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// recover replays the log past the snapshot and truncates a torn tail.
+func (a *Accumulator) recover() error {
+	info, err := a.f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	if size < a.base.Offset {
+		return fmt.Errorf("tally log has %d bytes, snapshot covers %d", size, a.base.Offset)
+	}
+	if _, err := a.f.Seek(a.base.Offset, io.SeekStart); err != nil {
+		return err
+	}
+	a.offset = a.base.Offset
+
+	// A crash can only tear the last record, so a bad record is discarded
+	// only when it runs to the end of the log.
+	r := bufio.NewReader(a.f)
+	var hdr [8]byte
+	for a.offset < size {
+		end := a.offset + int64(len(hdr))
+		if end > size {
+			break
+		}
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return err
+		}
+		n := binary.BigEndian.Uint32(hdr[:4])
+		if n > maxRecord {
+			return fmt.Errorf("tally log at %d: corrupt record length %d", a.offset, n)
+		}
+		if end += int64(n); end > size {
+			break
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+		if crc32.Checksum(data, castagnoli) != binary.BigEndian.Uint32(hdr[4:]) {
+			if end == size {
+				break
+			}
+			return fmt.Errorf("tally log at %d: checksum mismatch", a.offset)
+		}
+		ct := new(m1fp.Ciphertext)
+		if err := ct.UnmarshalBinary(data); err != nil {
+			return fmt.Errorf("tally log at %d: %w", a.offset, err)
+		}
+		if err := a.live.Add(ct); err != nil {
+			return fmt.Errorf("tally log at %d: %w", a.offset, err)
+		}
+		a.offset = end
+	}
+
+	if err := a.f.Truncate(a.offset); err != nil {
+		return err
+	}
+	if _, err := a.f.Seek(a.offset, io.SeekStart); err != nil {
+		return err
+	}
+	if err := a.f.Sync(); err != nil {
+		return err
+	}
+	a.synced = a.offset
+	if a.live.Ballots() >= a.every {
+		return a.snapshot()
+	}
+	return nil
+}
+
+// Add logs ct durably and adds it to the tally. Once Add returns nil the
+// ciphertext is counted, across crashes, exactly once. If the log cannot be
+// written the accumulator fails and must be reopened.
+func (a *Accumulator) Add(ct *m1fp.Ciphertext) error {
+	if ct == nil {
+		return fmt.Errorf("nil ciphertext")
+	}
+	data, err := ct.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	rec := make([]byte, 8+len(data))
+	binary.BigEndian.PutUint32(rec[:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(rec[4:8], crc32.Checksum(data, castagnoli))
+	copy(rec[8:], data)
+
+	a.mu.Lock()
+	if a.err != nil {
+		a.mu.Unlock()
+		return a.err
+	}
+	if err := a.live.Add(ct); err != nil {
+		a.mu.Unlock()
+		return err
+	}
+	if _, err := a.f.Write(rec); err != nil {
+		// The ciphertext is in memory but maybe not on disk.
+		a.fail(err)
+		a.mu.Unlock()
+		return a.err
+	}
+	a.offset += int64(len(rec))
+	end := a.offset
+	a.mu.Unlock()
+
+	if err := a.sync(end); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err == nil && a.live.Ballots() >= a.every {
+		// The ballot is durable in the log; a failed snapshot is retried
+		// after the next ballot and only delays recovery.
+		a.snapErr = a.snapshot()
+	}
+	return nil
+}
+
+// SnapshotError returns the error of the last snapshot taken automatically
+// by Add, or nil if it succeeded. A failed snapshot loses no ballot but
+// makes recovery replay a longer log.
+func (a *Accumulator) SnapshotError() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.snapErr
+}
+
+// sync makes the log durable up to offset end. Callers queue on syncMu; the
+// first one syncs every record written so far, so the callers behind it
+// usually find their record already durable.
+func (a *Accumulator) sync(end int64) error {
+	a.syncMu.Lock()
+	defer a.syncMu.Unlock()
+	a.mu.Lock()
+	if a.err != nil {
+		a.mu.Unlock()
+		return a.err
+	}
+	if a.synced >= end {
+		a.mu.Unlock()
+		return nil
+	}
+	target := a.offset
+	a.mu.Unlock()
+
+	err := a.f.Sync()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err != nil {
+		return a.err
+	}
+	if err != nil {
+		a.fail(err)
+		return a.err
+	}
+	a.synced = max(a.synced, target)
+	return nil
+}
+
+// fail refuses further use of the accumulator after the log could not be
+// written, and drops the records that are not known to be durable so that
+// reopening does not count ballots whose Add failed.
+func (a *Accumulator) fail(err error) {
+	a.err = fmt.Errorf("tally log failed, reopen the tally: %w", err)
+	if terr := a.f.Truncate(a.synced); terr != nil {
+		a.err = fmt.Errorf("%w (truncating the log: %v)", a.err, terr)
+	}
+}
+
+// Sum returns the encrypted tally and the number of ballots in it, which
+// may include ballots whose Add has not returned yet. An empty tally yields
+// the trivial encryption of zero.
+func (a *Accumulator) Sum() (*m1fp.Ciphertext, uint64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err != nil {
+		return nil, 0, a.err
+	}
+	return a.sum()
+}
+
+// Snapshot writes a snapshot of the current tally, so that reopening it
+// replays no log records.
+func (a *Accumulator) Snapshot() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.err != nil {
+		return a.err
+	}
+	return a.snapshot()
+}
+
+// Close writes a final snapshot and closes the log.
+func (a *Accumulator) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var err error
+	if a.err == nil {
+		err = a.snapshot()
+	}
+	if cerr := a.f.Close(); err == nil {
+		err = cerr
+	}
+	a.err = fmt.Errorf("tally closed")
+	return err
+}
+
+// sum adds the live ciphertexts to the snapshot sum.
+func (a *Accumulator) sum() (*m1fp.Ciphertext, uint64, error) {
+	live, n := a.live.Snapshot()
+	if a.base.Sum == nil {
+		return live, n, nil
+	}
+	total, err := a.base.Sum.Add(live, a.pk.Prec)
+	if err != nil {
+		return nil, 0, err
+	}
+	return total, a.base.Ballots + n, nil
+}
+
+// snapshot persists the current tally and starts a new live tally. The log
+// is synced first, so the snapshot never covers records lost in a crash.
+func (a *Accumulator) snapshot() error {
+	if a.synced < a.offset {
+		if err := a.f.Sync(); err != nil {
+			a.fail(err)
+			return a.err
+		}
+		a.synced = a.offset
+	}
+	total, n, err := a.sum()
+	if err != nil {
+		return err
+	}
+	next := snapshot{Ballots: n, Offset: a.offset}
+	if n > 0 {
+		next.Sum = total
+	}
+	data, err := json.Marshal(&next)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(a.dir, snapshotFile), data); err != nil {
+		return err
+	}
+	a.base = next
+	a.live = m1fp.NewTally(a.pk)
+	return nil
+}
+
+// writeFile replaces path with data atomically: the data is written to a
+// temporary file in the same directory, synced and renamed over path, and
+// the directory is synced so the rename survives a crash.
+func writeFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
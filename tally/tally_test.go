@@ -0,0 +1,242 @@
+package tally
+
+import (
+	"bytes"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/p4u/m1fp-go/m1fp"
+)
+
+func TestAccumulatorRecovers(t *testing.T) {
+	sk, pk, err := m1fp.KeyGen(256, m1fp.X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+	cts := make([]*m1fp.Ciphertext, 25)
+	for i := range cts {
+		if cts[i], _, err = m1fp.EncryptVote(pk, uint64(i%5), big.NewInt(int64(i+1))); err != nil {
+			t.Fatalf("EncryptVote failed: %v", err)
+		}
+	}
+	// check compares the tally with AddMany over the first n ciphertexts.
+	check := func(a *Accumulator, n int) {
+		t.Helper()
+		sum, ballots, err := a.Sum()
+		if err != nil {
+			t.Fatalf("Sum failed: %v", err)
+		}
+		if ballots != uint64(n) {
+			t.Fatalf("tally counts %d ballots, want %d", ballots, n)
+		}
+		want, _ := m1fp.AddMany(pk.Prec, cts[:n]...)
+		a1, _ := sum.MarshalBinary()
+		a2, _ := want.MarshalBinary()
+		if !bytes.Equal(a1, a2) {
+			got, _ := m1fp.DecryptVote(sk, sum)
+			t.Fatalf("tally of %d ballots decrypts to %d, differs from AddMany", n, got)
+		}
+	}
+
+	dir := t.TempDir()
+	a, err := Open(dir, pk, 10)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	for _, ct := range cts[:23] {
+		if err := a.Add(ct); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	check(a, 23)
+
+	// Crash after a snapshot at 20 ballots, with a record torn half-way.
+	a.f.Close()
+	data, _ := cts[23].MarshalBinary()
+	f, err := os.OpenFile(filepath.Join(dir, logFile), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("opening log failed: %v", err)
+	}
+	f.Write([]byte{0, 0, 1, 0, 0xde, 0xad})
+	f.Write(data[:10])
+	f.Close()
+
+	a, err = Open(dir, pk, 10)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	if a.base.Ballots != 20 {
+		t.Fatalf("snapshot covers %d ballots, want 20", a.base.Ballots)
+	}
+	check(a, 23)
+	for _, ct := range cts[23:] {
+		if err := a.Add(ct); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// A clean reopen replays nothing and counts nothing twice.
+	a, err = Open(dir, pk, 10)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	if a.live.Ballots() != 0 {
+		t.Fatalf("replayed %d ballots after a final snapshot", a.live.Ballots())
+	}
+	check(a, 25)
+	a.Close()
+}
+
+func TestAccumulatorRejectsCorruptLog(t *testing.T) {
+	_, pk, err := m1fp.KeyGen(256, m1fp.X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+	dir := t.TempDir()
+	a, err := Open(dir, pk, 100)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	for i := range 10 {
+		ct, _, err := m1fp.EncryptVote(pk, uint64(i), big.NewInt(int64(i+1)))
+		if err != nil {
+			t.Fatalf("EncryptVote failed: %v", err)
+		}
+		if err := a.Add(ct); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	a.f.Close()
+
+	// Flip a byte inside the first record: the nine records after it are
+	// durable ballots, so the log must be reported, not truncated.
+	path := filepath.Join(dir, logFile)
+	log, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading log failed: %v", err)
+	}
+	corrupt := bytes.Clone(log)
+	corrupt[12] ^= 0x01
+	if err := os.WriteFile(path, corrupt, 0o644); err != nil {
+		t.Fatalf("writing log failed: %v", err)
+	}
+	if _, err := Open(dir, pk, 100); err == nil {
+		t.Fatalf("Open accepted a log corrupted in the middle")
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, corrupt) {
+		t.Fatalf("Open modified a corrupt log: %d bytes left of %d", len(got), len(corrupt))
+	}
+
+	// Once repaired, every ballot is back.
+	if err := os.WriteFile(path, log, 0o644); err != nil {
+		t.Fatalf("writing log failed: %v", err)
+	}
+	a, err = Open(dir, pk, 100)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	if _, ballots, _ := a.Sum(); ballots != 10 {
+		t.Fatalf("tally counts %d ballots, want 10", ballots)
+	}
+	a.Close()
+}
+
+func TestAccumulatorConcurrentAdd(t *testing.T) {
+	sk, pk, err := m1fp.KeyGen(256, m1fp.X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+	dir := t.TempDir()
+	a, err := Open(dir, pk, 50)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	const workers, each = 16, 20
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range each {
+				ct, _, err := m1fp.EncryptVote(pk, 1, big.NewInt(int64(w*each+i+1)))
+				if err == nil {
+					err = a.Add(ct)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := a.SnapshotError(); err != nil {
+		t.Fatalf("snapshot failed: %v", err)
+	}
+	a.f.Close()
+
+	// Every acknowledged ballot survives a crash.
+	a, err = Open(dir, pk, 50)
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer a.Close()
+	sum, ballots, err := a.Sum()
+	if err != nil {
+		t.Fatalf("Sum failed: %v", err)
+	}
+	if got, _ := m1fp.DecryptVote(sk, sum); ballots != workers*each || got != workers*each {
+		t.Fatalf("tally counts %d ballots decrypting to %d, want %d", ballots, got, workers*each)
+	}
+}
+
+func TestAccumulatorRecordsSnapshotErrors(t *testing.T) {
+	_, pk, err := m1fp.KeyGen(256, m1fp.X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+	dir := t.TempDir()
+	a, err := Open(dir, pk, 2)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer a.Close()
+
+	// A non-empty directory in place of the snapshot makes the rename fail.
+	block := filepath.Join(dir, snapshotFile, "block")
+	if err := os.MkdirAll(block, 0o755); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	add := func(v uint64) {
+		t.Helper()
+		ct, _, _ := m1fp.EncryptVote(pk, v, big.NewInt(int64(v+1)))
+		if err := a.Add(ct); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	add(1)
+	add(2)
+	if a.SnapshotError() == nil {
+		t.Fatalf("failed snapshot not reported")
+	}
+
+	os.RemoveAll(filepath.Join(dir, snapshotFile))
+	add(3)
+	if err := a.SnapshotError(); err != nil {
+		t.Fatalf("snapshot still failing: %v", err)
+	}
+	if _, ballots, _ := a.Sum(); ballots != 3 {
+		t.Fatalf("tally counts %d ballots, want 3", ballots)
+	}
+}
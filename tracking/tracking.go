@@ -0,0 +1,261 @@
+// Package tracking derives ballot tracking codes and voter receipts.
+//
+// As in ElectionGuard, codes are chained over the bulletin board: the code
+// of the ballot at index i is
+//
+//	code_i = SHA-256(code_{i-1} || manifest hash || serialized ciphertext_i)
+//
+// starting from code_{-1} = SHA-256("m1fp/tracking/seed" || manifest hash).
+// Every code therefore depends on the election and on every ballot logged
+// before it, so a voter who finds their code on the board learns that their
+// ballot, and the board prefix it was cast on, were recorded.
+package tracking
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/p4u/m1fp-go/board"
+	"github.com/p4u/m1fp-go/m1fp"
+	"github.com/p4u/m1fp-go/manifest"
+)
+
+// ShortBytes is the number of code bytes rendered by Code.Short (80 bits).
+const ShortBytes = 10
+
+// seedDomain prefixes the hash that starts every chain.
+const seedDomain = "m1fp/tracking/seed"
+
+// encoding is unpadded RFC 4648 base32, whose alphabet has no 0, 1, 8 or 9.
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// Code is a ballot tracking code.
+type Code [sha256.Size]byte
+
+// Seed returns the code that precedes the first ballot of an election.
+func Seed(h manifest.Hash) Code {
+	return sha256.Sum256(append([]byte(seedDomain), h[:]...))
+}
+
+// Next returns the code of ct when it follows the ballot with code prev.
+func Next(prev Code, h manifest.Hash, ct *m1fp.Ciphertext) (Code, error) {
+	data, err := ct.MarshalBinary()
+	if err != nil {
+		return Code{}, err
+	}
+	buf := make([]byte, 0, len(prev)+len(h)+len(data))
+	buf = append(buf, prev[:]...)
+	buf = append(buf, h[:]...)
+	buf = append(buf, data...)
+	return sha256.Sum256(buf), nil
+}
+
+// String returns the full code in hexadecimal.
+func (c Code) String() string {
+	return hex.EncodeToString(c[:])
+}
+
+// MarshalText encodes the full code in hexadecimal.
+func (c Code) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText decodes a full hexadecimal code.
+func (c *Code) UnmarshalText(text []byte) error {
+	b, err := hex.DecodeString(string(text))
+	if err != nil {
+		return fmt.Errorf("tracking code: %w", err)
+	}
+	if len(b) != len(c) {
+		return fmt.Errorf("tracking code must be %d bytes", len(c))
+	}
+	copy(c[:], b)
+	return nil
+}
+
+// Short renders the first ShortBytes bytes of the code in base32, in groups
+// of four characters, e.g. "7KQF-XW2M-AB3D-ZP4E".
+func (c Code) Short() string {
+	s := c.compact()
+	groups := make([]string, 0, len(s)/4)
+	for i := 0; i < len(s); i += 4 {
+		groups = append(groups, s[i:min(i+4, len(s))])
+	}
+	return strings.Join(groups, "-")
+}
+
+// Matches reports whether text, as typed by a voter, is this code: either
+// the full hexadecimal code or its short form, ignoring case, spaces and
+// dashes.
+func (c Code) Matches(text string) bool {
+	norm := normalize(text)
+	return norm == strings.ToUpper(c.String()) || norm == c.compact()
+}
+
+// compact returns the short form without dashes.
+func (c Code) compact() string {
+	return encoding.EncodeToString(c[:ShortBytes])
+}
+
+// normalize uppercases a typed code and strips its spaces and dashes.
+func normalize(text string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(text))
+}
+
+// Chain returns the tracking codes of every ballot logged on b.
+func Chain(b *board.Board, h manifest.Hash) ([]Code, error) {
+	return NewTracker(b, h).Codes()
+}
+
+// Tracker keeps the tracking codes of a board, extending the chain as
+// ballots are logged rather than recomputing it on every query. It is safe
+// for concurrent use.
+type Tracker struct {
+	mu    sync.Mutex
+	b     *board.Board
+	h     manifest.Hash
+	codes []Code
+	full  map[Code]uint64   // Index of every code
+	short map[string]uint64 // Index of the first code with each compact short form
+}
+
+// NewTracker returns a tracker for the ballots of election h logged on b.
+func NewTracker(b *board.Board, h manifest.Hash) *Tracker {
+	return &Tracker{b: b, h: h, full: make(map[Code]uint64), short: make(map[string]uint64)}
+}
+
+// update chains the codes of the ballots logged since the last call. The
+// caller holds t.mu.
+func (t *Tracker) update() error {
+	prev := Seed(t.h)
+	if n := len(t.codes); n > 0 {
+		prev = t.codes[n-1]
+	}
+	for i := uint64(len(t.codes)); i < t.b.Size(); i++ {
+		ct, err := t.b.Entry(i)
+		if err != nil {
+			return err
+		}
+		code, err := Next(prev, t.h, ct)
+		if err != nil {
+			return fmt.Errorf("entry %d: %w", i, err)
+		}
+		t.codes = append(t.codes, code)
+		t.full[code] = i
+		if _, ok := t.short[code.compact()]; !ok {
+			t.short[code.compact()] = i
+		}
+		prev = code
+	}
+	return nil
+}
+
+// Codes returns the tracking codes of every ballot logged so far.
+func (t *Tracker) Codes() ([]Code, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.update(); err != nil {
+		return nil, err
+	}
+	return slices.Clone(t.codes), nil
+}
+
+// Lookup finds the ballot whose tracking code matches text and returns its
+// index.
+func (t *Tracker) Lookup(text string) (uint64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.update(); err != nil {
+		return 0, err
+	}
+	norm := normalize(text)
+	var c Code
+	if err := c.UnmarshalText([]byte(norm)); err == nil {
+		if i, ok := t.full[c]; ok {
+			return i, nil
+		}
+	} else if i, ok := t.short[norm]; ok {
+		return i, nil
+	}
+	return 0, fmt.Errorf("tracking code %q not found on the board", text)
+}
+
+// Receipt lets a voter check, without trusting the board operator, that
+// their ballot was recorded under its tracking code.
+type Receipt struct {
+	Index    uint64                `json:"index"`
+	Previous Code                  `json:"previous"` // Code of the preceding ballot
+	Code     Code                  `json:"code"`
+	Head     *board.TreeHead       `json:"head"`
+	Proof    *board.InclusionProof `json:"proof"`
+}
+
+// Issue returns the receipt of the ballot logged at index, against a
+// freshly signed tree head.
+func (t *Tracker) Issue(index uint64) (*Receipt, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.update(); err != nil {
+		return nil, err
+	}
+	if index >= uint64(len(t.codes)) {
+		return nil, fmt.Errorf("entry %d beyond %d entries", index, len(t.codes))
+	}
+	head, err := t.b.TreeHead()
+	if err != nil {
+		return nil, err
+	}
+	proof, err := t.b.InclusionProof(index, head.Size)
+	if err != nil {
+		return nil, err
+	}
+	r := &Receipt{Index: index, Previous: Seed(t.h), Code: t.codes[index], Head: head, Proof: proof}
+	if index > 0 {
+		r.Previous = t.codes[index-1]
+	}
+	return r, nil
+}
+
+// Verify checks that the receipt covers ct: the tree head is signed by the
+// board key operator for the election h, ct is logged at the receipt index,
+// and the tracking code chains from the previous one.
+//
+// The receipt does not carry the ballots logged before ct, so Verify can only
+// check that Previous is the election seed for the first ballot. For later
+// ballots it shows that the code commits to ct after Previous; that Previous
+// is the code of the ballot logged at Index-1 is checked by anyone holding
+// the board, e.g. by comparing with Tracker.Codes.
+func (r *Receipt) Verify(operator ed25519.PublicKey, h manifest.Hash, ct *m1fp.Ciphertext) error {
+	if r == nil || r.Head == nil || r.Proof == nil {
+		return fmt.Errorf("incomplete receipt")
+	}
+	if err := board.VerifyTreeHead(operator, r.Head); err != nil {
+		return err
+	}
+	if r.Head.Manifest != h {
+		return fmt.Errorf("receipt belongs to another election")
+	}
+	if r.Proof.Index != r.Index {
+		return fmt.Errorf("inclusion proof for entry %d, receipt for %d", r.Proof.Index, r.Index)
+	}
+	if err := board.VerifyInclusion(r.Head, ct, r.Proof); err != nil {
+		return err
+	}
+	if r.Index == 0 && r.Previous != Seed(h) {
+		return fmt.Errorf("first ballot must chain from the election seed")
+	}
+	code, err := Next(r.Previous, h, ct)
+	if err != nil {
+		return err
+	}
+	if code != r.Code {
+		return fmt.Errorf("tracking code does not match the ballot")
+	}
+	return nil
+}
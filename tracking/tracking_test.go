@@ -0,0 +1,98 @@
+package tracking
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/p4u/m1fp-go/board"
+	"github.com/p4u/m1fp-go/m1fp"
+	"github.com/p4u/m1fp-go/manifest"
+)
+
+func TestTrackingCodesAndReceipts(t *testing.T) {
+	_, pk, err := m1fp.KeyGen(256, m1fp.X)
+	if err != nil {
+		t.Fatalf("KeyGen failed: %v", err)
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	h := manifest.Hash{7}
+	b, err := board.Open(filepath.Join(t.TempDir(), "board.log"), h, pk, key)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer b.Close()
+
+	var cts []*m1fp.Ciphertext
+	var codes []Code
+	prev := Seed(h)
+	tracker := NewTracker(b, h)
+	for _, v := range []uint64{1, 0, 1, 1} {
+		ct, _, err := m1fp.EncryptVote(pk, v, nil)
+		if err != nil {
+			t.Fatalf("EncryptVote failed: %v", err)
+		}
+		if _, err := b.Append(ct); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+		code, err := Next(prev, h, ct)
+		if err != nil {
+			t.Fatalf("Next failed: %v", err)
+		}
+		cts, codes, prev = append(cts, ct), append(codes, code), code
+
+		// The tracker picks up each ballot as it is logged.
+		if i, err := tracker.Lookup(code.String()); err != nil || i != uint64(len(codes)-1) {
+			t.Fatalf("Lookup of the newest code = %d, %v; want %d", i, err, len(codes)-1)
+		}
+	}
+
+	chain, err := Chain(b, h)
+	if err != nil {
+		t.Fatalf("Chain failed: %v", err)
+	}
+	for i := range codes {
+		if chain[i] != codes[i] {
+			t.Fatalf("code %d differs between voter and board", i)
+		}
+	}
+
+	short := codes[2].Short()
+	if len(short) != 19 || strings.Count(short, "-") != 3 {
+		t.Fatalf("unexpected short code %q", short)
+	}
+	typed := strings.ToLower(strings.ReplaceAll(short, "-", " "))
+	if i, err := tracker.Lookup(typed); err != nil || i != 2 {
+		t.Fatalf("Lookup(%q) = %d, %v; want 2", typed, i, err)
+	}
+	if _, err := NewTracker(b, manifest.Hash{8}).Lookup(short); err == nil {
+		t.Fatalf("code found under another election")
+	}
+
+	if _, err := tracker.Lookup(Seed(h).String()); err == nil {
+		t.Fatalf("election seed found as a ballot code")
+	}
+
+	r, err := tracker.Issue(2)
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+	if r.Code != codes[2] {
+		t.Fatalf("receipt code %s, want %s", r.Code, codes[2])
+	}
+	if err := r.Verify(b.PublicKey(), h, cts[2]); err != nil {
+		t.Fatalf("valid receipt rejected: %v", err)
+	}
+	if err := r.Verify(b.PublicKey(), h, cts[1]); err == nil {
+		t.Fatalf("receipt accepted for another ballot")
+	}
+	r.Previous = codes[0]
+	if err := r.Verify(b.PublicKey(), h, cts[2]); err == nil {
+		t.Fatalf("receipt with a broken chain accepted")
+	}
+}
@@ -0,0 +1,181 @@
+// Package transcript implements the Fiat–Shamir transcripts shared by the
+// zero-knowledge proofs built on top of m1fp ciphertexts.
+//
+// A transcript is a SHA-256 hash over a sequence of records. Every record is
+// encoded as
+//
+//	tag (1 byte) || len(label) (uint32 BE) || label || len(value) (uint32 BE) || value
+//
+// with the following tags and value encodings:
+//
+//	0x00 domain      value = empty; written once by New with the domain as label
+//	0x01 message     value = raw bytes
+//	0x02 uint64      value = 8 bytes, big endian
+//	0x03 integer     value = sign (0x00 non-negative, 0x01 negative) || |v| big endian, no leading zeros
+//	0x04 public key  value = prec (uint16 BE) || n (uint16 BE) || len(X) (uint32 BE) || len(H) (uint32 BE) || X || H
+//	0x05 ciphertext  value = n (uint16 BE) || len(C1) (uint32 BE) || C1 || len(C2) (uint32 BE) || C2
+//	0x10 challenge   value = modulus, big endian, no leading zeros
+//	0x11 output      value = the derived challenge, big endian, no leading zeros
+//
+// Integers inside public keys and ciphertexts use the big-endian encoding of
+// math/big (Int.Bytes), so zero is the empty string. The public key encoding
+// is byte-for-byte the one produced by PublicKey.MarshalBinary.
+//
+// A challenge modulo q is derived by first appending a challenge record
+// (0x10) with the caller's label and q, then computing seed = SHA-256 of all
+// records so far and expanding it as SHA-256(seed || counter) for counter =
+// 0, 1, ... (uint32 BE) until ⌈(bitlen(q) + 128) / 8⌉ bytes are available.
+// Those bytes, read as a big-endian integer, are reduced mod q; the 128 extra
+// bits make the modular bias negligible. The result is then appended as an
+// output record (0x11) with the same label, so later challenges depend on it.
+package transcript
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"math/big"
+)
+
+// Record tags, see the package documentation.
+const (
+	tagDomain     = 0x00
+	tagMessage    = 0x01
+	tagUint64     = 0x02
+	tagInteger    = 0x03
+	tagPublicKey  = 0x04
+	tagCiphertext = 0x05
+	tagChallenge  = 0x10
+	tagOutput     = 0x11
+)
+
+// securityMargin is the number of extra bits drawn before reducing a
+// challenge modulo q.
+const securityMargin = 128
+
+// Ciphertext is the view of an m1fp ciphertext that a transcript encodes.
+type Ciphertext interface {
+	GetC1Int() *big.Int
+	GetC2Int() *big.Int
+	GetDigitCount() int
+}
+
+// Transcript accumulates labeled public values and derives challenges from them.
+type Transcript struct {
+	h hash.Hash
+}
+
+// New starts a transcript separated from any other protocol by domain.
+func New(domain string) *Transcript {
+	t := &Transcript{h: sha256.New()}
+	t.record(tagDomain, domain, nil)
+	return t
+}
+
+// Clone returns an independent copy of the transcript state.
+func (t *Transcript) Clone() *Transcript {
+	c := &Transcript{h: sha256.New()}
+	state, err := t.h.(interface{ MarshalBinary() ([]byte, error) }).MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+	if err := c.h.(interface{ UnmarshalBinary([]byte) error }).UnmarshalBinary(state); err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// AppendMessage appends raw bytes, such as identifiers or hashes.
+func (t *Transcript) AppendMessage(label string, msg []byte) {
+	t.record(tagMessage, label, msg)
+}
+
+// AppendUint64 appends an unsigned integer.
+func (t *Transcript) AppendUint64(label string, v uint64) {
+	t.record(tagUint64, label, binary.BigEndian.AppendUint64(nil, v))
+}
+
+// AppendBigInt appends an arbitrary precision integer. A nil value is
+// encoded as zero.
+func (t *Transcript) AppendBigInt(label string, v *big.Int) {
+	t.record(tagInteger, label, encodeInt(v))
+}
+
+// AppendPublicKey appends the public parameters of an m1fp public key.
+func (t *Transcript) AppendPublicKey(label string, prec, n uint16, x, h *big.Int) {
+	xb, hb := bytesOf(x), bytesOf(h)
+	v := binary.BigEndian.AppendUint16(nil, prec)
+	v = binary.BigEndian.AppendUint16(v, n)
+	v = binary.BigEndian.AppendUint32(v, uint32(len(xb)))
+	v = binary.BigEndian.AppendUint32(v, uint32(len(hb)))
+	v = append(v, xb...)
+	v = append(v, hb...)
+	t.record(tagPublicKey, label, v)
+}
+
+// AppendCiphertext appends both components of a ciphertext and its digit count.
+func (t *Transcript) AppendCiphertext(label string, ct Ciphertext) {
+	c1, c2 := bytesOf(ct.GetC1Int()), bytesOf(ct.GetC2Int())
+	v := binary.BigEndian.AppendUint16(nil, uint16(ct.GetDigitCount()))
+	v = binary.BigEndian.AppendUint32(v, uint32(len(c1)))
+	v = append(v, c1...)
+	v = binary.BigEndian.AppendUint32(v, uint32(len(c2)))
+	v = append(v, c2...)
+	t.record(tagCiphertext, label, v)
+}
+
+// Challenge derives a challenge uniformly distributed in [0, q), up to a
+// statistical distance of 2^-128. Use q = D for challenges in Z_D.
+func (t *Transcript) Challenge(label string, q *big.Int) *big.Int {
+	if q == nil || q.Sign() <= 0 {
+		panic("transcript: challenge modulus must be positive")
+	}
+	t.record(tagChallenge, label, q.Bytes())
+	seed := t.h.Sum(nil)
+
+	need := (q.BitLen() + securityMargin + 7) / 8
+	out := make([]byte, 0, need+sha256.Size)
+	for counter := uint32(0); len(out) < need; counter++ {
+		block := sha256.New()
+		block.Write(seed)
+		block.Write(binary.BigEndian.AppendUint32(nil, counter))
+		out = block.Sum(out)
+	}
+
+	c := new(big.Int).SetBytes(out[:need])
+	c.Mod(c, q)
+	t.record(tagOutput, label, c.Bytes())
+	return c
+}
+
+// ChallengeBits derives a challenge in [0, 2^bits).
+func (t *Transcript) ChallengeBits(label string, bits uint) *big.Int {
+	return t.Challenge(label, new(big.Int).Lsh(big.NewInt(1), bits))
+}
+
+// record writes one framed record into the hash.
+func (t *Transcript) record(tag byte, label string, value []byte) {
+	buf := make([]byte, 0, 9+len(label)+len(value))
+	buf = append(buf, tag)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(label)))
+	buf = append(buf, label...)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(value)))
+	buf = append(buf, value...)
+	t.h.Write(buf)
+}
+
+// encodeInt encodes a signed integer as sign byte followed by its magnitude.
+func encodeInt(v *big.Int) []byte {
+	if v == nil || v.Sign() >= 0 {
+		return append([]byte{0x00}, bytesOf(v)...)
+	}
+	return append([]byte{0x01}, v.Bytes()...)
+}
+
+// bytesOf returns the big-endian magnitude of v, treating nil as zero.
+func bytesOf(v *big.Int) []byte {
+	if v == nil {
+		return nil
+	}
+	return v.Bytes()
+}